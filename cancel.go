@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// upstreamRecord mirrors the request record served by mock-openai-server at
+// /debug/requests/{id}.
+type upstreamRecord struct {
+	ClientDisconnected       bool       `json:"client_disconnected"`
+	DisconnectedAt           *time.Time `json:"disconnected_at"`
+	FinishedAt               *time.Time `json:"finished_at"`
+	Completed                bool       `json:"completed"`
+	ChunksSent               int        `json:"chunks_sent"`
+	ChunksAfterDisconnect    int        `json:"chunks_after_disconnect"`
+	CompletionTokensCharged  int        `json:"completion_tokens_charged"`
+	CompletionTokensReceived int        `json:"completion_tokens_received"`
+}
+
+// cancellation starts a stream, cancels the context after the first content
+// chunk and checks how quickly the client and the upstream stop. The upstream
+// record is fetched through doer, so custom headers and the report recorder
+// apply to it too.
+func cancellation(ctx context.Context, client *openai.Client, doer openai.HTTPDoer, model string) error {
+	fmt.Println("----- Stream Cancellation Test -----")
+
+	req := openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: "Write a 2000 word essay about the history of lightning research.",
+			},
+		},
+		Stream:        true,
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.CreateChatCompletionStream(streamCtx, req)
+	if err != nil {
+		fmt.Printf("Stream creation error: %v\n", err)
+		return fmt.Errorf("create stream: %w", err)
+	}
+	defer stream.Close()
+
+	chunks := 0
+	for {
+		response, err := stream.Recv()
+		if err != nil {
+			fmt.Printf("Stream ended before any content (%d chunks): %v\n", chunks, err)
+			return fmt.Errorf("stream ended before any content: %w", err)
+		}
+		chunks++
+		if len(response.Choices) > 0 && response.Choices[0].Delta.Content != "" {
+			fmt.Printf("Received content after %d chunks: %q\n", chunks, response.Choices[0].Delta.Content)
+			break
+		}
+	}
+
+	cancelAt := time.Now()
+	cancel()
+	_, err = stream.Recv()
+	stopped := time.Since(cancelAt)
+
+	var failed []string
+	if errors.Is(err, context.Canceled) {
+		fmt.Printf("  ✓ client stream stopped %v after cancel\n", stopped)
+	} else {
+		fmt.Printf("  ✗ client stream returned %v after cancel (took %v), want context.Canceled\n", err, stopped)
+		failed = append(failed, "client stream not canceled")
+	}
+
+	requestID := stream.Header().Get("X-Request-Id")
+	if requestID == "" {
+		fmt.Println("  - upstream sent no X-Request-Id, cannot check server side (run against mock-openai-server)")
+		return cancelFailures(failed)
+	}
+
+	rec, err := waitUpstreamStopped(ctx, doer, requestID, 10*time.Second)
+	if err != nil {
+		fmt.Printf("  - cannot inspect upstream request %s: %v\n", requestID, err)
+		return cancelFailures(failed)
+	}
+	fmt.Println("Upstream request record:")
+	fmt.Println(MustMarshal(rec))
+
+	switch {
+	case rec.ClientDisconnected && rec.DisconnectedAt != nil:
+		fmt.Printf("  ✓ upstream noticed the disconnect %v after cancel\n", rec.DisconnectedAt.Sub(cancelAt))
+	case rec.Completed:
+		fmt.Println("  ✗ upstream ran the stream to completion without noticing the disconnect")
+		failed = append(failed, "upstream missed the disconnect")
+	default:
+		fmt.Println("  ✗ upstream has not noticed the disconnect yet")
+		failed = append(failed, "upstream missed the disconnect")
+	}
+
+	if rec.ChunksAfterDisconnect > 0 {
+		fmt.Printf("  ✗ upstream kept generating %d chunks after the disconnect\n", rec.ChunksAfterDisconnect)
+		failed = append(failed, "upstream kept generating")
+	} else {
+		fmt.Println("  ✓ upstream stopped generating at the disconnect")
+	}
+
+	if extra := rec.CompletionTokensCharged - rec.CompletionTokensReceived; extra > 0 {
+		fmt.Printf("  ✗ %d completion tokens charged but never delivered (charged %d, delivered %d)\n",
+			extra, rec.CompletionTokensCharged, rec.CompletionTokensReceived)
+		failed = append(failed, "undelivered tokens charged")
+	} else {
+		fmt.Printf("  ✓ only delivered tokens were charged (%d)\n", rec.CompletionTokensCharged)
+	}
+	return cancelFailures(failed)
+}
+
+func cancelFailures(failed []string) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("failed checks: %s", strings.Join(failed, "; "))
+}
+
+// waitUpstreamStopped polls the upstream debug endpoint until the request has
+// finished, either at the disconnect or at the end of the stream, or until
+// timeout elapses.
+func waitUpstreamStopped(ctx context.Context, doer openai.HTTPDoer, requestID string, timeout time.Duration) (upstreamRecord, error) {
+	url := strings.TrimSuffix(os.Getenv("BASE_URL"), "/") + "/debug/requests/" + requestID
+	deadline := time.Now().Add(timeout)
+	for {
+		rec, err := fetchUpstreamRecord(ctx, doer, url)
+		if err != nil {
+			return rec, err
+		}
+		if rec.FinishedAt != nil || time.Now().After(deadline) {
+			return rec, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func fetchUpstreamRecord(ctx context.Context, doer openai.HTTPDoer, url string) (upstreamRecord, error) {
+	var rec upstreamRecord
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return rec, err
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("API_KEY"))
+	resp, err := doer.Do(req)
+	if err != nil {
+		return rec, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rec, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rec); err != nil {
+		return rec, fmt.Errorf("decode %s: %w", url, err)
+	}
+	return rec, nil
+}
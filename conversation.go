@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// conversation replays a scripted multi-turn history, including an assistant
+// tool call and named participants, then checks that the final answer recalls
+// earlier turns and follows the system and developer instructions.
+func conversation(ctx context.Context, client *openai.Client, model string) error {
+	fmt.Println("----- Multi-turn Conversation Test -----")
+
+	toolCallID := "call_weather_shanghai"
+	req := openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "You are a concise assistant. End every reply with the word OVER in capital letters.",
+			},
+			{
+				Role:    openai.ChatMessageRoleDeveloper,
+				Content: "Whenever you mention the user's favourite colour, write the colour in ALL CAPITAL LETTERS.",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Name:    "alice",
+				Content: "Hi, I'm Alice. My favourite colour is teal. Please remember it.",
+			},
+			{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: "Nice to meet you, Alice! I'll remember that your favourite colour is TEAL. OVER",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Name:    "alice",
+				Content: "What's the weather in Shanghai right now?",
+			},
+			{
+				Role: openai.ChatMessageRoleAssistant,
+				Name: "weather_bot",
+				ToolCalls: []openai.ToolCall{
+					{
+						ID:   toolCallID,
+						Type: openai.ToolTypeFunction,
+						Function: openai.FunctionCall{
+							Name:      "get_current_weather",
+							Arguments: `{"location": "Shanghai", "unit": "celsius"}`,
+						},
+					},
+				},
+			},
+			{
+				Role:       openai.ChatMessageRoleTool,
+				Name:       "get_current_weather",
+				Content:    GetCurrentWeather("Shanghai", "celsius"),
+				ToolCallID: toolCallID,
+			},
+			{
+				Role:    openai.ChatMessageRoleAssistant,
+				Name:    "weather_bot",
+				Content: "It is currently 13 degrees celsius in Shanghai. OVER",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Name:    "alice",
+				Content: "Quick recap in one sentence: what is my name, what is my favourite colour, and what temperature did you report for Shanghai?",
+			},
+		},
+		Tools: []openai.Tool{weatherTool},
+	}
+
+	fmt.Println("Conversation request:")
+	fmt.Println(MustMarshal(req))
+	fmt.Println("--------------------------------")
+
+	resp, err := client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		fmt.Printf("Conversation error: %v\n", err)
+		fmt.Println("\nRunnable cURL command for debugging:")
+		fmt.Println(requestToCurl(req))
+		return err
+	}
+
+	fmt.Println("Conversation response choices:")
+	fmt.Println(MustMarshal(resp.Choices))
+	fmt.Println("--------------------------------")
+
+	if len(resp.Choices) == 0 {
+		fmt.Println("  ✗ no choices returned")
+		return fmt.Errorf("no choices returned")
+	}
+	msg := resp.Choices[0].Message
+	if len(msg.ToolCalls) > 0 {
+		fmt.Println("  ✗ model called a tool instead of answering from history")
+		return fmt.Errorf("model called a tool instead of answering from history")
+	}
+
+	checks := []struct {
+		name string
+		ok   bool
+	}{
+		{"recalls user name (Alice)", strings.Contains(strings.ToLower(msg.Content), "alice")},
+		{"recalls favourite colour (teal)", strings.Contains(strings.ToLower(msg.Content), "teal")},
+		{"recalls tool result (13 degrees)", strings.Contains(msg.Content, "13")},
+		{"follows developer message (TEAL in capitals)", strings.Contains(msg.Content, "TEAL")},
+		{"follows system message (ends with OVER)", strings.HasSuffix(strings.TrimRight(strings.TrimSpace(msg.Content), ".!"), "OVER")},
+	}
+	var failed []string
+	for _, c := range checks {
+		if c.ok {
+			fmt.Println("  ✓", c.name)
+		} else {
+			fmt.Println("  ✗", c.name)
+			failed = append(failed, c.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed checks: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -27,11 +27,37 @@ func requestToCurl(req openai.ChatCompletionRequest) string {
 	return curl
 }
 
-func function(ctx context.Context, client *openai.Client) {
+// weatherTool declares GetCurrentWeather to the model.
+var weatherTool = openai.Tool{
+	Type: openai.ToolTypeFunction,
+	Function: &openai.FunctionDefinition{
+		Name:        "get_current_weather",
+		Description: "Get the current weather in a given location",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"location": map[string]interface{}{
+					"type":        "string",
+					"description": "The city and state, e.g. Beijing",
+				},
+				"unit": map[string]interface{}{
+					"type":        "string",
+					"enum":        []string{"celsius", "fahrenheit"},
+					"description": "Units the temperature will be returned in, default is celsius",
+				},
+			},
+			"required": []string{
+				"location",
+			},
+		},
+	},
+}
+
+func function(ctx context.Context, client *openai.Client, model string) error {
 	fmt.Println("----- function call multiple rounds request -----")
 	// Step 1: send the conversation and available functions to the model
 	req := openai.ChatCompletionRequest{
-		Model: os.Getenv("MODEL"),
+		Model: model,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleSystem,
@@ -42,32 +68,7 @@ func function(ctx context.Context, client *openai.Client) {
 				Content: "What is the weather like in Beijing today?",
 			},
 		},
-		Tools: []openai.Tool{
-			{
-				Type: openai.ToolTypeFunction,
-				Function: &openai.FunctionDefinition{
-					Name:        "get_current_weather",
-					Description: "Get the current weather in a given location",
-					Parameters: map[string]interface{}{
-						"type": "object",
-						"properties": map[string]interface{}{
-							"location": map[string]interface{}{
-								"type":        "string",
-								"description": "The city and state, e.g. Beijing",
-							},
-							"unit": map[string]interface{}{
-								"type":        "string",
-								"enum":        []string{"celsius", "fahrenheit"},
-								"description": "Units the temperature will be returned in, default is celsius",
-							},
-						},
-						"required": []string{
-							"location",
-						},
-					},
-				},
-			},
-		},
+		Tools: []openai.Tool{weatherTool},
 	}
 
 	fmt.Println("--------------------------------")
@@ -77,7 +78,11 @@ func function(ctx context.Context, client *openai.Client) {
 		fmt.Printf("chat error: %v\n", err)
 		fmt.Println("\nRunnable cURL command for debugging:")
 		fmt.Println(requestToCurl(req))
-		return
+		return fmt.Errorf("round 1: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		fmt.Println("Round 1 response has no choices")
+		return fmt.Errorf("round 1: no choices returned")
 	}
 	fmt.Println("Round 1 response choices", string(MustMarshal(resp.Choices)))
 	fmt.Println("--------------------------------")
@@ -116,9 +121,14 @@ func function(ctx context.Context, client *openai.Client) {
 		fmt.Printf("second chat error: %v, resp: %v\n", err, secondResp)
 		fmt.Println("\nRunnable cURL command for debugging:")
 		fmt.Println(requestToCurl(req))
-		return
+		return fmt.Errorf("round 2: %w", err)
 	}
 	fmt.Println("Round 2 RespChoice", MustMarshal(secondResp.Choices))
+
+	if len(resp.Choices[0].Message.ToolCalls) == 0 {
+		return fmt.Errorf("model did not call %s", weatherTool.Function.Name)
+	}
+	return nil
 }
 
 func CallAvailableFunctions(name, arguments string) (string, error) {
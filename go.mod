@@ -3,8 +3,10 @@ module github.com/phosae/llm-test
 go 1.24.1
 
 require (
+	github.com/evanphx/json-patch/v5 v5.9.11
 	github.com/sashabaranov/go-openai v1.41.1
 	golang.org/x/oauth2 v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require cloud.google.com/go/compute/metadata v0.3.0 // indirect
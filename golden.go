@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// goldenSeed is sent with every golden request so providers that honour
+// seeds return reproducible samples.
+const goldenSeed = 42
+
+// goldenCase is a deterministic request whose normalized response is stored
+// per model and compared on later runs.
+type goldenCase struct {
+	name     string
+	messages []openai.ChatCompletionMessage
+	tools    []openai.Tool
+}
+
+var goldenCases = []goldenCase{
+	{
+		name: "text",
+		messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: "List the eight planets of the solar system in order from the sun, one per line, names only.",
+			},
+		},
+	},
+	{
+		name: "tool",
+		messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "You are the best assistant in the world",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: "What is the weather like in Beijing today? Use celsius.",
+			},
+		},
+		tools: []openai.Tool{weatherTool},
+	},
+}
+
+// goldenResponse is the normalized, provider-independent part of a response.
+type goldenResponse struct {
+	Model             string           `json:"model"`
+	Case              string           `json:"case"`
+	RecordedAt        time.Time        `json:"recorded_at"`
+	SystemFingerprint string           `json:"system_fingerprint,omitempty"`
+	FinishReason      string           `json:"finish_reason"`
+	Content           string           `json:"content"`
+	ToolCalls         []goldenToolCall `json:"tool_calls,omitempty"`
+}
+
+type goldenToolCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type goldenOptions struct {
+	dir       string
+	update    bool
+	threshold float64
+}
+
+// golden runs every golden case with temperature 0 and a fixed seed, then
+// records the normalized response or compares it with the stored one.
+func golden(ctx context.Context, client *openai.Client, model string, opts goldenOptions) error {
+	fmt.Println("----- Golden Output Regression Test -----")
+	var errs []error
+
+	for _, c := range goldenCases {
+		fmt.Printf("\n=== Golden case: %s ===\n", c.name)
+		req := openai.ChatCompletionRequest{
+			Model:    model,
+			Messages: c.messages,
+			Tools:    c.tools,
+			// go-openai omits a zero Temperature, which leaves the server's
+			// default (1 for OpenAI). The smallest positive float32 is sent
+			// instead and behaves as temperature 0.
+			Temperature: math.SmallestNonzeroFloat32,
+			Seed:        intPtr(goldenSeed),
+		}
+
+		resp, err := client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			fmt.Printf("Golden case %s error: %v\n", c.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+		if len(resp.Choices) == 0 {
+			fmt.Printf("Golden case %s error: no choices returned\n", c.name)
+			errs = append(errs, fmt.Errorf("%s: no choices returned", c.name))
+			continue
+		}
+		got := normalizeGolden(model, c.name, resp)
+
+		path := goldenPath(opts.dir, model, c.name)
+		want, err := readGolden(path)
+		if opts.update || errors.Is(err, os.ErrNotExist) {
+			if err := writeGolden(path, got); err != nil {
+				fmt.Printf("Golden case %s error: %v\n", c.name, err)
+				errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+				continue
+			}
+			fmt.Printf("  ✓ recorded %s\n", path)
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Golden case %s error: %v\n", c.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+
+		drifts := compareGolden(want, got, opts.threshold)
+		if want.SystemFingerprint != "" && got.SystemFingerprint != "" && want.SystemFingerprint != got.SystemFingerprint {
+			fmt.Printf("  - system_fingerprint changed: %s -> %s\n", want.SystemFingerprint, got.SystemFingerprint)
+		}
+		if len(drifts) == 0 {
+			fmt.Printf("  ✓ matches golden recorded at %s (content similarity %.2f)\n",
+				want.RecordedAt.Format(time.RFC3339), similarity(want.Content, got.Content))
+			continue
+		}
+		fmt.Printf("  ✗ drift from golden recorded at %s:\n", want.RecordedAt.Format(time.RFC3339))
+		for _, d := range drifts {
+			fmt.Println("      -", d)
+		}
+		fmt.Println("    golden:", MustMarshal(want))
+		fmt.Println("    got:   ", MustMarshal(got))
+		errs = append(errs, fmt.Errorf("%s: drift: %s", c.name, strings.Join(drifts, "; ")))
+	}
+	return errors.Join(errs...)
+}
+
+func normalizeGolden(model, caseName string, resp openai.ChatCompletionResponse) goldenResponse {
+	choice := resp.Choices[0]
+	g := goldenResponse{
+		Model:             model,
+		Case:              caseName,
+		RecordedAt:        time.Now().UTC(),
+		SystemFingerprint: resp.SystemFingerprint,
+		FinishReason:      string(choice.FinishReason),
+		Content:           normalizeText(choice.Message.Content),
+	}
+	for _, tc := range choice.Message.ToolCalls {
+		g.ToolCalls = append(g.ToolCalls, goldenToolCall{
+			Name:      tc.Function.Name,
+			Arguments: canonicalJSON(tc.Function.Arguments),
+		})
+	}
+	return g
+}
+
+// compareGolden lists every difference between want and got that counts as drift.
+func compareGolden(want, got goldenResponse, threshold float64) []string {
+	var drifts []string
+	if want.FinishReason != got.FinishReason {
+		drifts = append(drifts, fmt.Sprintf("finish_reason %q -> %q", want.FinishReason, got.FinishReason))
+	}
+	if s := similarity(want.Content, got.Content); s < threshold {
+		drifts = append(drifts, fmt.Sprintf("content similarity %.2f below threshold %.2f", s, threshold))
+	}
+	if len(want.ToolCalls) != len(got.ToolCalls) {
+		drifts = append(drifts, fmt.Sprintf("tool call count %d -> %d", len(want.ToolCalls), len(got.ToolCalls)))
+		return drifts
+	}
+	for i := range want.ToolCalls {
+		w, g := want.ToolCalls[i], got.ToolCalls[i]
+		if w.Name != g.Name {
+			drifts = append(drifts, fmt.Sprintf("tool_calls[%d] name %q -> %q", i, w.Name, g.Name))
+		}
+		if w.Arguments != g.Arguments {
+			drifts = append(drifts, fmt.Sprintf("tool_calls[%d] arguments %s -> %s", i, w.Arguments, g.Arguments))
+		}
+	}
+	return drifts
+}
+
+var spaceRe = regexp.MustCompile(`\s+`)
+
+func normalizeText(s string) string {
+	return spaceRe.ReplaceAllString(strings.TrimSpace(s), " ")
+}
+
+// canonicalJSON re-encodes a JSON document with sorted keys and no extra
+// whitespace; invalid JSON is returned trimmed as is.
+func canonicalJSON(s string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return strings.TrimSpace(s)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// similarity returns 1 minus the word-level edit distance of a and b
+// divided by the longer length, so identical texts score 1.
+func similarity(a, b string) float64 {
+	wa, wb := strings.Fields(strings.ToLower(a)), strings.Fields(strings.ToLower(b))
+	if len(wa) == 0 && len(wb) == 0 {
+		return 1
+	}
+	prev := make([]int, len(wb)+1)
+	cur := make([]int, len(wb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(wa); i++ {
+		cur[0] = i
+		for j := 1; j <= len(wb); j++ {
+			cost := 1
+			if wa[i-1] == wb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(wb)])/float64(max(len(wa), len(wb)))
+}
+
+var unsafePathRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// goldenPath keeps each model's files in its own directory under dir. A
+// model named "." or ".." must not resolve to dir or its parent.
+func goldenPath(dir, model, caseName string) string {
+	name := unsafePathRe.ReplaceAllString(model, "_")
+	if strings.Trim(name, ".") == "" {
+		name = strings.Repeat("_", len(name)+1)
+	}
+	return filepath.Join(dir, name, caseName+".json")
+}
+
+func readGolden(path string) (goldenResponse, error) {
+	var g goldenResponse
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return g, err
+	}
+	if err := json.Unmarshal(data, &g); err != nil {
+		return g, fmt.Errorf("failed to parse golden file %s: %w", path, err)
+	}
+	return g, nil
+}
+
+func writeGolden(path string, g goldenResponse) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create golden dir: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(MustMarshal(g)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write golden file: %w", err)
+	}
+	return nil
+}
+
+func intPtr(i int) *int {
+	return &i
+}
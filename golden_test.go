@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{"both empty", "", "", 1},
+		{"identical", "the quick brown fox", "the quick brown fox", 1},
+		{"case and spacing", "The  Quick\nbrown fox", "the quick brown FOX", 1},
+		{"one empty", "a b c", "", 0},
+		{"one word changed", "the quick brown fox", "the quick red fox", 0.75},
+		{"one word added", "a b c", "a b c d", 0.75},
+		{"disjoint", "a b", "c d", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"key order", `{"b": 1, "a": [true, null]}`, `{"a":[true,null],"b":1}`},
+		{"nested", "{\n  \"x\": {\"z\": \"s\", \"y\": 2.5}\n}", `{"x":{"y":2.5,"z":"s"}}`},
+		{"not JSON", "  {city: Paris}\n", "{city: Paris}"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonicalJSON(tt.in); got != tt.want {
+				t.Errorf("canonicalJSON(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoldenPath(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-4o", "golden/gpt-4o/c.json"},
+		{"org/model:v1", "golden/org_model_v1/c.json"},
+		{"", "golden/_/c.json"},
+		{".", "golden/__/c.json"},
+		{"..", "golden/___/c.json"},
+		{"../etc", "golden/.._etc/c.json"},
+	}
+	for _, tt := range tests {
+		if got := goldenPath("golden", tt.model, "c"); got != filepath.FromSlash(tt.want) {
+			t.Errorf("goldenPath(%q) = %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
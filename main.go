@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 )
@@ -25,9 +26,15 @@ func (h *headerFlags) Set(value string) error {
 func main() {
 	// Define command-line flags
 	var (
-		testTypes     = flag.String("test", "", "Test types: f(unction), v(ision), s(tream). Use comma-separated for multiple: f,v,s")
-		showHelp      = flag.Bool("h", false, "Show help")
-		customHeaders headerFlags
+		testTypes       = flag.String("test", "", "Test types: f(unction), v(ision), s(tream), c(onversation), x (cancel), g(olden), m(odels). Use comma-separated for multiple: f,v,s")
+		goldenDir       = flag.String("golden-dir", "golden", "Directory holding golden responses for -test g")
+		goldenUpdate    = flag.Bool("golden-update", false, "Overwrite golden responses instead of comparing")
+		goldenThreshold = flag.Float64("golden-threshold", 0.8, "Minimum content similarity (0-1) before golden drift is reported")
+		reportPath      = flag.String("report", "", "Write a self-contained HTML report of the run to this file")
+		reportPrev      = flag.String("report-prev", "", "Previous HTML report to diff against (default: the existing -report file)")
+		allModels       = flag.Bool("all-models", false, "Run the selected tests against every model listed by GET /models")
+		showHelp        = flag.Bool("h", false, "Show help")
+		customHeaders   headerFlags
 	)
 
 	flag.Var(&customHeaders, "H", "Add custom headers (curl-like). Format: 'Key: Value'. Can be used multiple times.")
@@ -38,30 +45,41 @@ func main() {
 	if *showHelp {
 		fmt.Println("Usage: go run . [flags]")
 		fmt.Println("\nFlags:")
-		fmt.Println("  -test string    Test types: f(unction), v(ision), s(tream)")
+		fmt.Println("  -test string    Test types: f(unction), v(ision), s(tream), c(onversation), x (cancel), g(olden), m(odels)")
 		fmt.Println("                  Examples: -test f      (function only)")
 		fmt.Println("                           -test v      (vision only)")
 		fmt.Println("                           -test s      (stream only)")
-		fmt.Println("                           -test f,v,s  (all)")
+		fmt.Println("                           -test c      (multi-turn conversation only)")
+		fmt.Println("                           -test x      (stream cancellation only)")
+		fmt.Println("                           -test g      (golden output regression only)")
+		fmt.Println("                           -test m      (models listing only)")
+		fmt.Println("                           -test f,v,s,c  (the default set)")
+		fmt.Println("  -golden-dir     Directory holding golden responses (default: golden)")
+		fmt.Println("  -golden-update  Overwrite golden responses instead of comparing")
+		fmt.Println("  -golden-threshold  Minimum content similarity before drift is reported (default: 0.8)")
+		fmt.Println("  -report string  Write a self-contained HTML report of the run to this file")
+		fmt.Println("  -report-prev string  Previous report to diff against (default: the existing -report file)")
+		fmt.Println("  -all-models     Run the selected tests against every model listed by GET /models")
 		fmt.Println("  -H string       Add custom headers (curl-like). Format: 'Key: Value'")
 		fmt.Println("                  Can be used multiple times: -H 'Auth: Bearer token' -H 'Content-Type: application/json'")
 		fmt.Println("  -h              Show this help message")
-		fmt.Println("\nDefault behavior (no -test flag): Test all features")
+		fmt.Println("\nDefault behavior (no -test flag): f,v,s,c; x, g and m only run when selected")
 		fmt.Println("\nEnvironment Variables:")
 		fmt.Println("  API_KEY     - Your API key")
 		fmt.Println("  BASE_URL    - Custom base URL (optional)")
-		fmt.Println("  MODEL       - Model to use (e.g., gpt-4-vision-preview)")
+		fmt.Println("  MODEL       - Model to use (e.g., gpt-4-vision-preview), ignored with -all-models")
 		return
 	}
 
 	// Parse test types
-	var shouldTestFunction, shouldTestVision, shouldTestStream bool
+	var shouldTestFunction, shouldTestVision, shouldTestStream, shouldTestConversation, shouldTestCancel, shouldTestGolden, shouldTestModels bool
 
 	if *testTypes == "" {
-		// Default: test all
+		// Default: f,v,s,c
 		shouldTestFunction = true
 		shouldTestVision = true
 		shouldTestStream = true
+		shouldTestConversation = true
 	} else {
 		// Parse comma-separated values
 		types := strings.Split(strings.ToLower(*testTypes), ",")
@@ -74,9 +92,17 @@ func main() {
 				shouldTestVision = true
 			case "s", "stream":
 				shouldTestStream = true
+			case "c", "conversation":
+				shouldTestConversation = true
+			case "x", "cancel":
+				shouldTestCancel = true
+			case "g", "golden":
+				shouldTestGolden = true
+			case "m", "models":
+				shouldTestModels = true
 			default:
 				fmt.Printf("Unknown test type: %s\n", t)
-				fmt.Println("Valid types: f(unction), v(ision), s(tream)")
+				fmt.Println("Valid types: f(unction), v(ision), s(tream), c(onversation), x (cancel), g(olden), m(odels)")
 				return
 			}
 		}
@@ -99,46 +125,149 @@ func main() {
 		headerMap[key] = value
 	}
 
-	if len(headerMap) > 0 {
-		cfg.HTTPClient = &httpDoer{headers: headerMap}
+	// Capture HTTP exchanges for the HTML report
+	var recorder *exchangeRecorder
+	if *reportPath != "" {
+		recorder = &exchangeRecorder{}
+	}
+
+	if len(headerMap) > 0 || recorder != nil {
+		cfg.HTTPClient = &httpDoer{headers: headerMap, recorder: recorder}
 	} else {
 		cfg.HTTPClient = http.DefaultClient
 	}
 
 	client := openai.NewClientWithConfig(cfg)
 
-	// Test function calling
-	if shouldTestFunction {
-		fmt.Println("🔧 Testing Function Calling...")
-		function(ctx, client)
+	var report *Report
+	if *reportPath != "" {
+		report = NewReport(cfg.BaseURL)
 	}
 
-	// Test vision API
-	if shouldTestVision {
+	// runTests runs the selected tests against model
+	runTests := func(model string) {
+		var ran bool
+		// run prints the banner, runs fn and files its outcome in the report
+		run := func(feature, banner string, fn func() error) {
+			if ran {
+				fmt.Println("\n" + strings.Repeat("=", 50))
+			}
+			ran = true
+			fmt.Println(banner)
+			recorder.Take()
+			start := time.Now()
+			err := fn()
+			if report != nil {
+				report.Add(model, feature, err, time.Since(start), recorder.Take())
+			}
+		}
+
+		// Test models listing
+		if shouldTestModels {
+			run("models", "📋 Testing Models API...", func() error {
+				return models(ctx, client, model)
+			})
+		}
+
+		// Test function calling
 		if shouldTestFunction {
-			fmt.Println("\n" + strings.Repeat("=", 50))
+			run("function", "🔧 Testing Function Calling...", func() error {
+				return function(ctx, client, model)
+			})
+		}
+
+		// Test vision API
+		if shouldTestVision {
+			run("vision", "👁️  Testing Vision API...", func() error {
+				return vision(ctx, client, model)
+			})
+		}
+
+		// Test streaming
+		if shouldTestStream {
+			run("stream", "🌊 Testing Stream API...", func() error {
+				return stream(ctx, client, model)
+			})
+		}
+
+		// Test multi-turn conversation
+		if shouldTestConversation {
+			run("conversation", "💬 Testing Multi-turn Conversation...", func() error {
+				return conversation(ctx, client, model)
+			})
+		}
+
+		// Test stream cancellation
+		if shouldTestCancel {
+			run("cancel", "✂️  Testing Stream Cancellation...", func() error {
+				return cancellation(ctx, client, cfg.HTTPClient, model)
+			})
 		}
-		fmt.Println("👁️  Testing Vision API...")
-		vision(ctx, client)
-	}
 
-	// Test streaming
-	if shouldTestStream {
-		if shouldTestFunction || shouldTestVision {
-			fmt.Println("\n" + strings.Repeat("=", 50))
+		// Test golden output regression
+		if shouldTestGolden {
+			run("golden", "🏅 Testing Golden Output Regression...", func() error {
+				return golden(ctx, client, model, goldenOptions{
+					dir:       *goldenDir,
+					update:    *goldenUpdate,
+					threshold: *goldenThreshold,
+				})
+			})
 		}
-		fmt.Println("🌊 Testing Stream API...")
-		stream(ctx, client)
+	}
+
+	if *reportPath != "" {
+		defer writeReport(report, *reportPath, *reportPrev)
+	}
+
+	if !*allModels {
+		runTests(os.Getenv("MODEL"))
+		return
+	}
+
+	// Auto-discovery: run the selected tests once per listed model
+	discovered, err := discoverModels(ctx, client)
+	if err != nil {
+		fmt.Printf("Model discovery error: %v\n", err)
+		return
+	}
+	fmt.Printf("Discovered %d models: %s\n", len(discovered), strings.Join(discovered, ", "))
+	for _, m := range discovered {
+		fmt.Println("\n" + strings.Repeat("#", 50))
+		fmt.Printf("🤖 Model: %s\n", m)
+		fmt.Println(strings.Repeat("#", 50))
+		runTests(m)
 	}
 }
 
 type httpDoer struct {
-	headers map[string]string
+	headers  map[string]string
+	recorder *exchangeRecorder
 }
 
 func (h *httpDoer) Do(req *http.Request) (*http.Response, error) {
 	for k, v := range h.headers {
 		req.Header.Set(k, v)
 	}
+	if h.recorder != nil {
+		return h.recorder.Do(req)
+	}
 	return http.DefaultClient.Do(req)
 }
+
+// writeReport renders the HTML report, diffing against prevPath or, when that
+// is empty, against the report previously written to path.
+func writeReport(report *Report, path, prevPath string) {
+	if prevPath == "" {
+		prevPath = path
+	}
+	prev, err := LoadReport(prevPath)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Previous report ignored: %v\n", err)
+	}
+	if err := report.WriteHTML(path, prev); err != nil {
+		fmt.Printf("Report error: %v\n", err)
+		return
+	}
+	fmt.Printf("\n📊 Report written to %s\n", path)
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MessagesRequest is an Anthropic Messages API request.
+type MessagesRequest struct {
+	Model         string             `json:"model"`
+	System        AnthropicContent   `json:"system"`
+	Messages      []AnthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Stream        bool               `json:"stream,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []AnthropicTool    `json:"tools,omitempty"`
+	ToolChoice    *struct {
+		Type string `json:"type"` // auto, any, tool or none
+		Name string `json:"name,omitempty"`
+	} `json:"tool_choice,omitempty"`
+	Thinking *struct {
+		Type         string `json:"type"`
+		BudgetTokens int    `json:"budget_tokens"`
+	} `json:"thinking,omitempty"`
+}
+
+type AnthropicMessage struct {
+	Role    string           `json:"role"`
+	Content AnthropicContent `json:"content"`
+}
+
+// AnthropicContent is a string or an array of content blocks.
+type AnthropicContent []AnthropicBlock
+
+func (c *AnthropicContent) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		*c = AnthropicContent{{Type: "text", Text: text}}
+		return nil
+	}
+	var blocks []AnthropicBlock
+	if err := json.Unmarshal(b, &blocks); err != nil {
+		return fmt.Errorf("content must be a string or an array of content blocks")
+	}
+	*c = blocks
+	return nil
+}
+
+// text joins the text blocks.
+func (c AnthropicContent) text() string {
+	var texts []string
+	for _, b := range c {
+		if b.Type == "text" {
+			texts = append(texts, b.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// AnthropicBlock is a content block of a request or a response.
+type AnthropicBlock struct {
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Signature string           `json:"signature,omitempty"`
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Input     json.RawMessage  `json:"input,omitempty"`
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   AnthropicContent `json:"content,omitempty"` // of tool_result blocks
+	IsError   bool             `json:"is_error,omitempty"`
+	Source    json.RawMessage  `json:"source,omitempty"` // of image and document blocks
+}
+
+type AnthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type MessagesResponse struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"`
+	Role         string           `json:"role"`
+	Model        string           `json:"model"`
+	Content      []AnthropicBlock `json:"content"`
+	StopReason   *string          `json:"stop_reason"`
+	StopSequence *string          `json:"stop_sequence"`
+	Usage        AnthropicUsage   `json:"usage"`
+}
+
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// mockSignature stands in for the signature Anthropic puts on thinking blocks.
+const mockSignature = "bW9jay10aGlua2luZy1zaWduYXR1cmU="
+
+var anthropicCannedReply = Reply{
+	Content:          "This is a mock response from the Anthropic Messages API. The request was processed successfully.",
+	FinishReason:     "stop",
+	PromptTokens:     10,
+	CompletionTokens: 20,
+}
+
+// anthropicErrorTypes are the error types Anthropic uses per status.
+var anthropicErrorTypes = map[int]string{
+	400: "invalid_request_error",
+	401: "authentication_error",
+	402: "billing_error",
+	403: "permission_error",
+	404: "not_found_error",
+	413: "request_too_large",
+	429: "rate_limit_error",
+	500: "api_error",
+	503: "overloaded_error",
+	504: "timeout_error",
+	529: "overloaded_error",
+}
+
+// anthropicError is the error body, also sent as the error event of streams.
+func anthropicError(status int, message string) map[string]interface{} {
+	typ, ok := anthropicErrorTypes[status]
+	if !ok {
+		typ = "api_error"
+		if status < 500 {
+			typ = "invalid_request_error"
+		}
+	}
+	return map[string]interface{}{
+		"type":  "error",
+		"error": map[string]string{"type": typ, "message": message},
+	}
+}
+
+func writeAnthropicError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(anthropicError(status, message))
+}
+
+// anthropicStopReason maps OpenAI finish reasons; Anthropic ones pass through.
+func anthropicStopReason(finish string) string {
+	switch finish {
+	case "stop":
+		return "end_turn"
+	case "tool_calls":
+		return "tool_use"
+	case "length":
+		return "max_tokens"
+	case "content_filter":
+		return "refusal"
+	}
+	return finish
+}
+
+// anthropicToolID renames generated call_ ids to Anthropic's toolu_ form.
+func anthropicToolID(id string) string {
+	if rest, ok := strings.CutPrefix(id, "call_"); ok {
+		return "toolu_" + rest
+	}
+	return id
+}
+
+func handleMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	delay, err := requestDelay(r)
+	if err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, fmt.Sprintf("invalid delay: %v", err))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var req MessagesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	log.Printf("Request received - RemoteAddr: %s, Method: %s, URL: %s, Model: %s", r.RemoteAddr, r.Method, r.URL.String(), req.Model)
+
+	if code, err := strconv.Atoi(req.Model); err == nil {
+		if errMsg, ok := ErrorModels[code]; ok {
+			writeAnthropicError(w, code, errMsg)
+			return
+		}
+	}
+	w, r, handled := applyFaults(w, r, apiMessages, req.Model, writeAnthropicError)
+	if handled {
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reply := replyFor(req.conversation(body))
+	if reply == nil {
+		canned := anthropicCannedReply
+		reply = &canned
+	}
+	if reply.Delay > 0 {
+		delay = reply.Delay
+	}
+	if req.Thinking != nil && req.Thinking.Type == "enabled" && reply.Reasoning == "" {
+		reply.Reasoning = "The user sent a request to the mock server. I will answer with the scripted response."
+	}
+
+	requestID := newRequestID()
+	tracker.Start(requestID, req.Model, req.Stream)
+	w.Header().Set("X-Request-Id", requestID)
+	w.Header().Set("Request-Id", requestID)
+
+	id := fmt.Sprintf("msg_mock%d", time.Now().UnixNano())
+	if req.Stream {
+		streamMessages(w, r, req, reply, id, requestID, delay)
+		return
+	}
+
+	if delay > 0 {
+		log.Printf("Non-streaming request: sleeping for %v", delay)
+		time.Sleep(delay)
+	}
+	stop := anthropicStopReason(reply.FinishReason)
+	resp := MessagesResponse{
+		ID:         id,
+		Type:       "message",
+		Role:       "assistant",
+		Model:      req.Model,
+		Content:    anthropicBlocks(reply),
+		StopReason: &stop,
+		Usage:      AnthropicUsage{InputTokens: reply.PromptTokens, OutputTokens: reply.CompletionTokens},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+
+	tracker.Update(requestID, func(rec *RequestRecord) {
+		now := time.Now()
+		rec.FinishedAt = &now
+		rec.Completed = true
+		rec.CompletionTokensCharged = reply.CompletionTokens
+		rec.CompletionTokensReceived = reply.CompletionTokens
+	})
+}
+
+// validate applies the checks of the real API that clients most often trip.
+func (req *MessagesRequest) validate() error {
+	if req.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens: Field required")
+	}
+	if len(req.Messages) == 0 {
+		return fmt.Errorf("messages: at least one message is required")
+	}
+	if t := req.Thinking; t != nil && t.Type == "enabled" {
+		if t.BudgetTokens < 1024 {
+			return fmt.Errorf("thinking.enabled.budget_tokens: Input should be greater than or equal to 1024")
+		}
+		if req.MaxTokens <= t.BudgetTokens {
+			return fmt.Errorf("`max_tokens` must be greater than `thinking.budget_tokens`")
+		}
+	}
+
+	// Every tool_use must be answered by a tool_result in the next message.
+	pending := map[string]bool{}
+	for i, m := range req.Messages {
+		for j, b := range m.Content {
+			if b.Type != "tool_result" {
+				continue
+			}
+			if !pending[b.ToolUseID] {
+				return fmt.Errorf("messages.%d.content.%d: unexpected `tool_use_id` found in `tool_result` blocks: %s. Each `tool_result` block must have a corresponding `tool_use` block in the previous message.", i, j, b.ToolUseID)
+			}
+			delete(pending, b.ToolUseID)
+		}
+		if len(pending) > 0 {
+			ids := make([]string, 0, len(pending))
+			for id := range pending {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			return fmt.Errorf("messages.%d: `tool_use` ids were found without `tool_result` blocks immediately after: %s. Each `tool_use` block must have a corresponding `tool_result` block in the next message.", i-1, strings.Join(ids, ", "))
+		}
+		if m.Role == "assistant" {
+			for _, b := range m.Content {
+				if b.Type == "tool_use" {
+					pending[b.ID] = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (req *MessagesRequest) conversation(body []byte) *Conversation {
+	conv := &Conversation{Model: req.Model}
+	json.Unmarshal(body, &conv.Fields)
+	for _, m := range req.Messages {
+		conv.LastRole = m.Role
+		if m.Role == "assistant" {
+			conv.Turn++
+			continue
+		}
+		var results []string
+		for _, b := range m.Content {
+			if b.Type == "tool_result" {
+				results = append(results, b.Content.text())
+			}
+		}
+		if len(results) > 0 {
+			conv.LastRole = "tool"
+			conv.LastToolResult = strings.Join(results, "\n")
+		} else {
+			conv.LastUser = m.Content.text()
+		}
+	}
+	for _, t := range req.Tools {
+		conv.Tools = append(conv.Tools, ToolSpec{Name: t.Name, Parameters: t.InputSchema})
+	}
+	if tc := req.ToolChoice; tc != nil {
+		conv.ToolChoice = map[string]string{"auto": "auto", "any": "required", "none": "none", "tool": tc.Name}[tc.Type]
+	}
+	return conv
+}
+
+// anthropicBlocks renders reply as thinking, text and tool_use blocks.
+func anthropicBlocks(reply *Reply) []AnthropicBlock {
+	blocks := []AnthropicBlock{}
+	if reply.Reasoning != "" {
+		blocks = append(blocks, AnthropicBlock{Type: "thinking", Thinking: reply.Reasoning, Signature: mockSignature})
+	}
+	if reply.Content != "" {
+		blocks = append(blocks, AnthropicBlock{Type: "text", Text: reply.Content})
+	}
+	for _, tc := range reply.ToolCalls {
+		blocks = append(blocks, AnthropicBlock{Type: "tool_use", ID: anthropicToolID(tc.ID), Name: tc.Function.Name, Input: argumentsObject(tc.Function.Arguments)})
+	}
+	return blocks
+}
+
+// streamMessages sends the full Anthropic event sequence: message_start,
+// ping, start/delta/stop for every content block, message_delta with the
+// stop reason and usage, and message_stop.
+func streamMessages(w http.ResponseWriter, r *http.Request, req MessagesRequest, reply *Reply, id, requestID string, delay time.Duration) {
+	stream := newSSEStream(w, r, requestID, apiMessages)
+	if stream == nil {
+		return
+	}
+	completed := false
+	defer func() { stream.finish(completed) }()
+
+	pause := reply.ChunkDelay
+	if pause == 0 {
+		pause = 20 * time.Millisecond
+	}
+	// next waits before an event, stopping when the client has gone away.
+	next := func(d time.Duration) bool {
+		return stream.wait(d) && !stream.disconnected()
+	}
+
+	if !next(0) {
+		return
+	}
+	stream.send("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id": id, "type": "message", "role": "assistant", "model": req.Model,
+			"content": []interface{}{}, "stop_reason": nil, "stop_sequence": nil,
+			"usage": AnthropicUsage{InputTokens: reply.PromptTokens, OutputTokens: 1},
+		},
+	}, 0)
+	stream.send("ping", map[string]string{"type": "ping"}, 0)
+
+	if delay > 0 {
+		log.Printf("Streaming request: delaying by %v", delay)
+	}
+	if !next(delay) {
+		return
+	}
+
+	index := 0
+	block := func(start map[string]interface{}, deltas []map[string]interface{}) bool {
+		stream.send("content_block_start", map[string]interface{}{"type": "content_block_start", "index": index, "content_block": start}, 0)
+		for _, d := range deltas {
+			if !next(pause) {
+				return false
+			}
+			tokens := 0
+			for _, k := range []string{"text", "thinking", "partial_json"} {
+				if s, ok := d[k].(string); ok {
+					tokens += countTokens(s)
+				}
+			}
+			stream.send("content_block_delta", map[string]interface{}{"type": "content_block_delta", "index": index, "delta": d}, tokens)
+		}
+		stream.send("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": index}, 0)
+		index++
+		return true
+	}
+
+	if reply.Reasoning != "" {
+		var deltas []map[string]interface{}
+		for _, chunk := range textChunks(reply.Reasoning) {
+			deltas = append(deltas, map[string]interface{}{"type": "thinking_delta", "thinking": chunk})
+		}
+		deltas = append(deltas, map[string]interface{}{"type": "signature_delta", "signature": mockSignature})
+		if !block(map[string]interface{}{"type": "thinking", "thinking": "", "signature": ""}, deltas) {
+			return
+		}
+	}
+	if reply.Content != "" {
+		var deltas []map[string]interface{}
+		for _, chunk := range textChunks(reply.Content) {
+			deltas = append(deltas, map[string]interface{}{"type": "text_delta", "text": chunk})
+		}
+		if !block(map[string]interface{}{"type": "text", "text": ""}, deltas) {
+			return
+		}
+	}
+	for _, tc := range reply.ToolCalls {
+		var deltas []map[string]interface{}
+		for _, frag := range argumentChunks(string(argumentsObject(tc.Function.Arguments))) {
+			deltas = append(deltas, map[string]interface{}{"type": "input_json_delta", "partial_json": frag})
+		}
+		start := map[string]interface{}{"type": "tool_use", "id": anthropicToolID(tc.ID), "name": tc.Function.Name, "input": map[string]interface{}{}}
+		if !block(start, deltas) {
+			return
+		}
+	}
+
+	if !next(pause) {
+		return
+	}
+	stream.send("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": anthropicStopReason(reply.FinishReason), "stop_sequence": nil},
+		"usage": map[string]int{"output_tokens": reply.CompletionTokens},
+	}, 0)
+	stream.send("message_stop", map[string]string{"type": "message_stop"}, 0)
+	completed = true
+}
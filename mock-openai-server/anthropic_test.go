@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMessagesRequestValidate(t *testing.T) {
+	const toolUse = `{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"f","input":{}},{"type":"tool_use","id":"t2","name":"f","input":{}}]}`
+	tests := []struct {
+		name string
+		req  string
+		want string // error substring, empty for valid
+	}{
+		{"valid", `{"max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`, ""},
+		{"missing max_tokens", `{"messages":[{"role":"user","content":"hi"}]}`, "max_tokens: Field required"},
+		{"no messages", `{"max_tokens":10,"messages":[]}`, "at least one message"},
+		{"thinking budget too small", `{"max_tokens":2000,"thinking":{"type":"enabled","budget_tokens":512},"messages":[{"role":"user","content":"hi"}]}`,
+			"greater than or equal to 1024"},
+		{"max_tokens not above budget", `{"max_tokens":1024,"thinking":{"type":"enabled","budget_tokens":1024},"messages":[{"role":"user","content":"hi"}]}`,
+			"must be greater than `thinking.budget_tokens`"},
+		{"thinking disabled", `{"max_tokens":10,"thinking":{"type":"disabled"},"messages":[{"role":"user","content":"hi"}]}`, ""},
+		{"tool results answered", `{"max_tokens":10,"messages":[{"role":"user","content":"hi"},` + toolUse + `,
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"t2","content":"a"},{"type":"tool_result","tool_use_id":"t1","content":"b"}]}]}`, ""},
+		{"tool result missing", `{"max_tokens":10,"messages":[{"role":"user","content":"hi"},` + toolUse + `,
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"b"}]}]}`,
+			"messages.1: `tool_use` ids were found without `tool_result` blocks immediately after: t2"},
+		{"tool results not next", `{"max_tokens":10,"messages":[{"role":"user","content":"hi"},` + toolUse + `,
+			{"role":"user","content":"go on"}]}`,
+			"ids were found without `tool_result` blocks immediately after: t1, t2"},
+		{"unknown tool_use_id", `{"max_tokens":10,"messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"x","content":"b"}]}]}`,
+			"messages.0.content.0: unexpected `tool_use_id` found in `tool_result` blocks: x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req MessagesRequest
+			if err := json.Unmarshal([]byte(tt.req), &req); err != nil {
+				t.Fatal(err)
+			}
+			err := req.validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("validate() = %v, want nil", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("validate() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
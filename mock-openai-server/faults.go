@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var faultsPath = flag.String("faults", "", "YAML/JSON file with fault rules: injected errors, hangs and broken streams")
+
+// The APIs fault rules can be limited to.
+const (
+	apiChat      = "chat"
+	apiMessages  = "messages"
+	apiGemini    = "gemini"
+	apiResponses = "responses"
+)
+
+// FaultRule injects failures into matching requests. The first matching rule
+// applies.
+type FaultRule struct {
+	Name  string     `yaml:"name"`
+	Match FaultMatch `yaml:"match"`
+
+	// Errors maps a status code to the fraction of requests answered with
+	// it, e.g. {429: 0.2, 503: 0.1}. Bodies have the shape and error type
+	// of the API the request was for.
+	Errors map[int]float64 `yaml:"errors"`
+	// RetryAfter is sent with injected 429, 503 and 529 errors. Defaults to
+	// 1s; negative omits the header.
+	RetryAfter time.Duration `yaml:"retry_after"`
+
+	// Rate is the fraction of the remaining matching requests that get the
+	// faults below. Defaults to 1.
+	Rate                 *float64      `yaml:"rate"`
+	Latency              time.Duration `yaml:"latency"`                // before answering
+	SlowChunks           time.Duration `yaml:"slow_chunks"`            // before every chunk
+	Hang                 bool          `yaml:"hang"`                   // accept the request and never answer
+	HangAfterChunks      int           `yaml:"hang_after_chunks"`      // stop a stream after N chunks, keeping the connection open
+	FailAfterChunks      int           `yaml:"fail_after_chunks"`      // end a stream with an error event after N chunks
+	FailStatus           int           `yaml:"fail_status"`            // status of that error event, default 500
+	MalformedAfterChunks int           `yaml:"malformed_after_chunks"` // send a chunk of broken JSON after N chunks
+	DropAfterChunks      int           `yaml:"drop_after_chunks"`      // abort the connection after N chunks
+	TruncateJSON         bool          `yaml:"truncate_json"`          // cut bodies, or the chunk at the drop, in half
+}
+
+// FaultMatch conditions must all hold; empty ones are ignored.
+type FaultMatch struct {
+	API        string            `yaml:"api"`         // chat, messages, gemini or responses
+	PathPrefix string            `yaml:"path_prefix"` // request path prefix
+	Model      string            `yaml:"model"`       // glob, e.g. "gpt-4o*"
+	Headers    map[string]string `yaml:"headers"`     // header value globs, e.g. {X-Test-Case: "retry-*"}
+}
+
+var faultRules []FaultRule
+
+func loadFaults(p string) ([]FaultRule, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Faults []FaultRule `yaml:"faults"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", p, err)
+	}
+	for i := range file.Faults {
+		if err := file.Faults[i].validate(); err != nil {
+			return nil, fmt.Errorf("%s: faults[%d] %s: %w", p, i, file.Faults[i].Name, err)
+		}
+	}
+	return file.Faults, nil
+}
+
+func (f *FaultRule) validate() error {
+	switch f.Match.API {
+	case "", apiChat, apiMessages, apiGemini, apiResponses:
+	default:
+		return fmt.Errorf("match.api %q: want chat, messages, gemini or responses", f.Match.API)
+	}
+	if _, err := path.Match(f.Match.Model, ""); err != nil {
+		return fmt.Errorf("match.model: %w", err)
+	}
+	for name, pattern := range f.Match.Headers {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("match.headers[%s]: %w", name, err)
+		}
+	}
+	total := 0.0
+	for code, rate := range f.Errors {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("errors: status %d is not an error status", code)
+		}
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("errors: rate %v for %d is outside [0, 1]", rate, code)
+		}
+		total += rate
+	}
+	if total > 1 {
+		return fmt.Errorf("errors: rates add up to %v, more than 1", total)
+	}
+	if f.Rate != nil && (*f.Rate < 0 || *f.Rate > 1) {
+		return fmt.Errorf("rate %v is outside [0, 1]", *f.Rate)
+	}
+	if f.HangAfterChunks < 0 || f.FailAfterChunks < 0 || f.MalformedAfterChunks < 0 || f.DropAfterChunks < 0 {
+		return fmt.Errorf("chunk counts must not be negative")
+	}
+	if f.FailStatus != 0 && (f.FailStatus < 400 || f.FailStatus > 599) {
+		return fmt.Errorf("fail_status %d is not an error status", f.FailStatus)
+	}
+	if f.FailStatus == 0 {
+		f.FailStatus = http.StatusInternalServerError
+	}
+	return nil
+}
+
+func (m *FaultMatch) matches(api, model string, r *http.Request) bool {
+	if m.API != "" && m.API != api {
+		return false
+	}
+	if m.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, m.PathPrefix) {
+		return false
+	}
+	if m.Model != "" {
+		if ok, _ := path.Match(m.Model, model); !ok {
+			return false
+		}
+	}
+	for name, pattern := range m.Headers {
+		if ok, _ := path.Match(pattern, r.Header.Get(name)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// rollError picks an injected error status, or 0 for none.
+func (f *FaultRule) rollError() int {
+	x := rand.Float64()
+	for code, rate := range f.Errors {
+		if x < rate {
+			return code
+		}
+		x -= rate
+	}
+	return 0
+}
+
+// rollDegrade reports whether the latency, hang and response faults apply
+// this time.
+func (f *FaultRule) rollDegrade() bool {
+	if f.Latency == 0 && f.SlowChunks == 0 && !f.Hang && f.HangAfterChunks == 0 && f.FailAfterChunks == 0 &&
+		f.MalformedAfterChunks == 0 && f.DropAfterChunks == 0 && !f.TruncateJSON {
+		return false
+	}
+	return f.Rate == nil || rand.Float64() < *f.Rate
+}
+
+type faultKey struct{}
+
+// faultFrom returns the stream faults attached to the request, if any.
+func faultFrom(r *http.Request) *FaultRule {
+	f, _ := r.Context().Value(faultKey{}).(*FaultRule)
+	return f
+}
+
+// applyFaults injects the faults of the first rule matching the request. It
+// answers with an injected error or hangs and returns handled, or returns r
+// carrying the stream faults for newSSEStream to apply and w truncating
+// plain bodies. writeError writes an error body in the shape of the API.
+func applyFaults(w http.ResponseWriter, r *http.Request, api, model string, writeError func(http.ResponseWriter, int, string)) (http.ResponseWriter, *http.Request, bool) {
+	var rule *FaultRule
+	for i := range faultRules {
+		if faultRules[i].Match.matches(api, model, r) {
+			rule = &faultRules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return w, r, false
+	}
+
+	if status := rule.rollError(); status != 0 {
+		log.Printf("Fault %q: answering with %d", rule.Name, status)
+		if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable || status == 529 {
+			switch {
+			case rule.RetryAfter == 0:
+				w.Header().Set("Retry-After", "1")
+			case rule.RetryAfter > 0:
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rule.RetryAfter.Seconds()))))
+			}
+		}
+		writeError(w, status, faultMessage(status))
+		return w, r, true
+	}
+	if !rule.rollDegrade() {
+		return w, r, false
+	}
+	if rule.Hang {
+		log.Printf("Fault %q: hanging until the client disconnects", rule.Name)
+		<-r.Context().Done()
+		return w, r, true
+	}
+	log.Printf("Fault %q: %s", rule.Name, rule)
+	if rule.Latency > 0 {
+		t := time.NewTimer(rule.Latency)
+		defer t.Stop()
+		select {
+		case <-r.Context().Done():
+			return w, r, true
+		case <-t.C:
+		}
+	}
+	if rule.TruncateJSON {
+		w = truncatingWriter{w}
+	}
+	return w, r.WithContext(context.WithValue(r.Context(), faultKey{}, rule)), false
+}
+
+// truncatingWriter sends half of every plain body write. The handlers encode
+// a response in a single write; streams are cut by sseStream instead.
+type truncatingWriter struct {
+	http.ResponseWriter
+}
+
+func (w truncatingWriter) Write(b []byte) (int, error) {
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		return w.ResponseWriter.Write(b)
+	}
+	w.Header().Del("Content-Length")
+	if _, err := w.ResponseWriter.Write(b[:len(b)/2]); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w truncatingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func faultMessage(status int) string {
+	text := http.StatusText(status)
+	switch {
+	case status == 529: // Anthropic's
+		text = "Overloaded"
+	case text == "":
+		text = "Error"
+	}
+	return fmt.Sprintf("injected fault: %d %s", status, text)
+}
+
+func (f *FaultRule) String() string {
+	var parts []string
+	if f.Latency > 0 {
+		parts = append(parts, "latency="+f.Latency.String())
+	}
+	if f.SlowChunks > 0 {
+		parts = append(parts, "slow_chunks="+f.SlowChunks.String())
+	}
+	if f.HangAfterChunks > 0 {
+		parts = append(parts, fmt.Sprintf("hang_after_chunks=%d", f.HangAfterChunks))
+	}
+	if f.FailAfterChunks > 0 {
+		parts = append(parts, fmt.Sprintf("fail_after_chunks=%d fail_status=%d", f.FailAfterChunks, f.FailStatus))
+	}
+	if f.MalformedAfterChunks > 0 {
+		parts = append(parts, fmt.Sprintf("malformed_after_chunks=%d", f.MalformedAfterChunks))
+	}
+	if f.DropAfterChunks > 0 {
+		parts = append(parts, fmt.Sprintf("drop_after_chunks=%d", f.DropAfterChunks))
+	}
+	if f.TruncateJSON {
+		parts = append(parts, "truncate_json")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// geminiPathRe matches generateContent paths under any prefix, e.g.
+// /v1beta/models/gemini-2.5-flash:streamGenerateContent or fastllmcurl's
+// /gemini/v1/models/{model}:generateContent.
+var geminiPathRe = regexp.MustCompile(`/models/([^/:]+):(generateContent|streamGenerateContent)$`)
+
+// GenerateContentRequest is a Gemini generateContent request.
+type GenerateContentRequest struct {
+	Contents          []GeminiContent `json:"contents"`
+	SystemInstruction *GeminiContent  `json:"systemInstruction,omitempty"`
+	Tools             []struct {
+		FunctionDeclarations []struct {
+			Name                 string                 `json:"name"`
+			Description          string                 `json:"description,omitempty"`
+			Parameters           map[string]interface{} `json:"parameters,omitempty"`
+			ParametersJSONSchema map[string]interface{} `json:"parametersJsonSchema,omitempty"`
+		} `json:"functionDeclarations"`
+	} `json:"tools,omitempty"`
+	ToolConfig *struct {
+		FunctionCallingConfig struct {
+			Mode                 string   `json:"mode"` // AUTO, ANY or NONE
+			AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+		} `json:"functionCallingConfig"`
+	} `json:"toolConfig,omitempty"`
+	GenerationConfig *struct {
+		MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+		ThinkingConfig  *struct {
+			IncludeThoughts bool `json:"includeThoughts,omitempty"`
+			ThinkingBudget  *int `json:"thinkingBudget,omitempty"`
+		} `json:"thinkingConfig,omitempty"`
+	} `json:"generationConfig,omitempty"`
+}
+
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+type GeminiPart struct {
+	Text             string                `json:"text,omitempty"`
+	Thought          bool                  `json:"thought,omitempty"`
+	ThoughtSignature string                `json:"thoughtSignature,omitempty"`
+	InlineData       json.RawMessage       `json:"inlineData,omitempty"`
+	FileData         json.RawMessage       `json:"fileData,omitempty"`
+	FunctionCall     *GeminiFunctionCall   `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResult `json:"functionResponse,omitempty"`
+}
+
+type GeminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args"`
+}
+
+type GeminiFunctionResult struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type GenerateContentResponse struct {
+	Candidates    []GeminiCandidate    `json:"candidates"`
+	UsageMetadata *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion  string               `json:"modelVersion"`
+	ResponseID    string               `json:"responseId"`
+}
+
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+	Index        int           `json:"index"`
+}
+
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount,omitempty"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+var geminiCannedReply = Reply{
+	Content:          "This is a mock response from the Gemini API. The request was processed successfully.",
+	FinishReason:     "stop",
+	PromptTokens:     10,
+	CompletionTokens: 20,
+}
+
+// googleStatuses are the canonical status names Google APIs send per code.
+var googleStatuses = map[int]string{
+	400: "INVALID_ARGUMENT",
+	401: "UNAUTHENTICATED",
+	403: "PERMISSION_DENIED",
+	404: "NOT_FOUND",
+	409: "ABORTED",
+	429: "RESOURCE_EXHAUSTED",
+	499: "CANCELLED",
+	500: "INTERNAL",
+	501: "NOT_IMPLEMENTED",
+	503: "UNAVAILABLE",
+	504: "DEADLINE_EXCEEDED",
+}
+
+// googleError is the error body, also sent as the last chunk of streams.
+func googleError(code int, message string) map[string]interface{} {
+	status, ok := googleStatuses[code]
+	if !ok {
+		status = "UNKNOWN"
+	}
+	return map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message, "status": status},
+	}
+}
+
+func writeGoogleError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(googleError(code, message))
+}
+
+// geminiFinishReason maps OpenAI finish reasons; Gemini reports function
+// calls with STOP.
+func geminiFinishReason(finish string) string {
+	switch finish {
+	case "stop", "tool_calls":
+		return "STOP"
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	}
+	return strings.ToUpper(finish)
+}
+
+func handleGemini(w http.ResponseWriter, r *http.Request) {
+	m := geminiPathRe.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		writeGoogleError(w, http.StatusNotFound, fmt.Sprintf("The requested URL %s was not found on this server.", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeGoogleError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	model, stream := m[1], m[2] == "streamGenerateContent"
+	sse := r.URL.Query().Get("alt") == "sse"
+
+	delay, err := requestDelay(r)
+	if err != nil {
+		writeGoogleError(w, http.StatusBadRequest, fmt.Sprintf("Invalid delay format: %v", err))
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeGoogleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var req GenerateContentRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON payload received. %v", err))
+		return
+	}
+
+	log.Printf("Request received - RemoteAddr: %s, Method: %s, URL: %s, Model: %s", r.RemoteAddr, r.Method, r.URL.String(), model)
+
+	if code, err := strconv.Atoi(model); err == nil {
+		if errMsg, ok := ErrorModels[code]; ok {
+			writeGoogleError(w, code, errMsg)
+			return
+		}
+	}
+	w, r, handled := applyFaults(w, r, apiGemini, model, writeGoogleError)
+	if handled {
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reply := replyFor(req.conversation(model, body))
+	if reply == nil {
+		canned := geminiCannedReply
+		reply = &canned
+	}
+	if reply.Delay > 0 {
+		delay = reply.Delay
+	}
+	includeThoughts := false
+	if gc := req.GenerationConfig; gc != nil && gc.ThinkingConfig != nil {
+		includeThoughts = gc.ThinkingConfig.IncludeThoughts
+	}
+	if includeThoughts && reply.Reasoning == "" {
+		reply.Reasoning = "The user sent a request to the mock server. I will answer with the scripted response."
+	}
+
+	requestID := newRequestID()
+	tracker.Start(requestID, model, stream)
+	w.Header().Set("X-Request-Id", requestID)
+
+	responseID := fmt.Sprintf("mock%d", time.Now().UnixNano())
+	if stream {
+		streamGemini(w, r, model, reply, includeThoughts, sse, responseID, requestID, delay)
+		return
+	}
+
+	if delay > 0 {
+		log.Printf("Non-streaming request: sleeping for %v", delay)
+		time.Sleep(delay)
+	}
+	var parts []GeminiPart
+	if includeThoughts {
+		parts = append(parts, GeminiPart{Text: reply.Reasoning, Thought: true})
+	}
+	if reply.Content != "" {
+		parts = append(parts, GeminiPart{Text: reply.Content})
+	}
+	parts = append(parts, geminiCallParts(reply)...)
+	resp := GenerateContentResponse{
+		Candidates: []GeminiCandidate{{
+			Content:      GeminiContent{Role: "model", Parts: parts},
+			FinishReason: geminiFinishReason(reply.FinishReason),
+		}},
+		UsageMetadata: geminiUsage(reply),
+		ModelVersion:  model,
+		ResponseID:    responseID,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+
+	tracker.Update(requestID, func(rec *RequestRecord) {
+		now := time.Now()
+		rec.FinishedAt = &now
+		rec.Completed = true
+		rec.CompletionTokensCharged = reply.CompletionTokens
+		rec.CompletionTokensReceived = reply.CompletionTokens
+	})
+}
+
+// validate applies the checks of the real API that clients most often trip.
+func (req *GenerateContentRequest) validate() error {
+	if len(req.Contents) == 0 {
+		return fmt.Errorf("* GenerateContentRequest.contents: contents is not specified")
+	}
+	for i, c := range req.Contents {
+		if c.Role != "" && c.Role != "user" && c.Role != "model" {
+			return fmt.Errorf("Please use a valid role: user, model.")
+		}
+		if len(c.Parts) == 0 {
+			return fmt.Errorf("* GenerateContentRequest.contents[%d].parts: contents.parts must not be empty.", i)
+		}
+	}
+	// A turn of function calls must be answered by as many function
+	// responses in the next turn.
+	for i := 0; i+1 < len(req.Contents); i++ {
+		calls, responses := 0, 0
+		for _, p := range req.Contents[i].Parts {
+			if p.FunctionCall != nil {
+				calls++
+			}
+		}
+		for _, p := range req.Contents[i+1].Parts {
+			if p.FunctionResponse != nil {
+				responses++
+			}
+		}
+		if (calls > 0 || responses > 0) && calls != responses {
+			return fmt.Errorf("Please ensure that the number of function response parts is equal to the number of function call parts of the function call turn.")
+		}
+	}
+	return nil
+}
+
+func (req *GenerateContentRequest) conversation(model string, body []byte) *Conversation {
+	conv := &Conversation{Model: model}
+	json.Unmarshal(body, &conv.Fields)
+	for _, c := range req.Contents {
+		conv.LastRole = c.Role
+		if c.Role == "model" {
+			conv.LastRole = "assistant"
+			conv.Turn++
+			continue
+		}
+		var texts, results []string
+		for _, p := range c.Parts {
+			if p.FunctionResponse != nil {
+				results = append(results, string(p.FunctionResponse.Response))
+			} else if p.Text != "" {
+				texts = append(texts, p.Text)
+			}
+		}
+		if len(results) > 0 {
+			conv.LastRole = "tool"
+			conv.LastToolResult = strings.Join(results, "\n")
+		} else {
+			conv.LastRole = "user"
+			conv.LastUser = strings.Join(texts, "\n")
+		}
+	}
+	for _, t := range req.Tools {
+		for _, fd := range t.FunctionDeclarations {
+			params := fd.Parameters
+			if params == nil {
+				params = fd.ParametersJSONSchema
+			}
+			conv.Tools = append(conv.Tools, ToolSpec{Name: fd.Name, Parameters: params})
+		}
+	}
+	if tc := req.ToolConfig; tc != nil {
+		fc := tc.FunctionCallingConfig
+		switch strings.ToUpper(fc.Mode) {
+		case "AUTO":
+			conv.ToolChoice = "auto"
+		case "NONE":
+			conv.ToolChoice = "none"
+		case "ANY":
+			conv.ToolChoice = "required"
+			if len(fc.AllowedFunctionNames) > 0 {
+				conv.ToolChoice = fc.AllowedFunctionNames[0]
+			}
+		}
+	}
+	return conv
+}
+
+// geminiCallParts renders the tool calls of reply as functionCall parts.
+// Gemini calls carry no ids; arguments are objects rather than strings.
+func geminiCallParts(reply *Reply) []GeminiPart {
+	var parts []GeminiPart
+	for _, tc := range reply.ToolCalls {
+		parts = append(parts, GeminiPart{FunctionCall: &GeminiFunctionCall{Name: tc.Function.Name, Args: argumentsObject(tc.Function.Arguments)}})
+	}
+	return parts
+}
+
+func geminiUsage(reply *Reply) *GeminiUsageMetadata {
+	// CompletionTokens includes the reasoning; Gemini counts thoughts apart
+	// from the candidates.
+	thoughts := min(countTokens(reply.Reasoning), reply.CompletionTokens)
+	return &GeminiUsageMetadata{
+		PromptTokenCount:     reply.PromptTokens,
+		CandidatesTokenCount: reply.CompletionTokens - thoughts,
+		ThoughtsTokenCount:   thoughts,
+		TotalTokenCount:      reply.PromptTokens + reply.CompletionTokens,
+	}
+}
+
+// streamGemini sends thought chunks, text chunks and one chunk per function
+// call, with finishReason and usageMetadata on the last chunk. Without
+// alt=sse the chunks are elements of one JSON array, as Google sends them.
+func streamGemini(w http.ResponseWriter, r *http.Request, model string, reply *Reply, includeThoughts, sse bool, responseID, requestID string, delay time.Duration) {
+	stream := newSSEStream(w, r, requestID, apiGemini)
+	if stream == nil {
+		return
+	}
+	if !sse {
+		w.Header().Set("Content-Type", "application/json")
+		stream.array = true
+	}
+	completed := false
+	defer func() { stream.finish(completed) }()
+
+	type chunk struct {
+		part   GeminiPart
+		tokens int
+	}
+	var chunks []chunk
+	if includeThoughts {
+		for _, text := range textChunks(reply.Reasoning) {
+			chunks = append(chunks, chunk{GeminiPart{Text: text, Thought: true}, 0})
+		}
+	}
+	if reply.Content != "" {
+		for _, text := range textChunks(reply.Content) {
+			chunks = append(chunks, chunk{GeminiPart{Text: text}, countTokens(text)})
+		}
+	}
+	for _, p := range geminiCallParts(reply) {
+		chunks = append(chunks, chunk{p, countTokens(string(p.FunctionCall.Args))})
+	}
+	if len(chunks) == 0 {
+		chunks = append(chunks, chunk{GeminiPart{Text: ""}, 0})
+	}
+
+	pause := reply.ChunkDelay
+	if pause == 0 {
+		pause = 20 * time.Millisecond
+	}
+	if delay > 0 {
+		log.Printf("Streaming request: delaying by %v", delay)
+	}
+	for i, c := range chunks {
+		d := pause
+		if i == 0 {
+			d = delay
+		}
+		if !stream.wait(d) || stream.disconnected() {
+			return
+		}
+		resp := GenerateContentResponse{
+			Candidates:   []GeminiCandidate{{Content: GeminiContent{Role: "model", Parts: []GeminiPart{c.part}}}},
+			ModelVersion: model,
+			ResponseID:   responseID,
+		}
+		if i == len(chunks)-1 {
+			resp.Candidates[0].FinishReason = geminiFinishReason(reply.FinishReason)
+			resp.UsageMetadata = geminiUsage(reply)
+		}
+		stream.send("", resp, c.tokens)
+	}
+	if stream.array {
+		stream.raw("]")
+	}
+	completed = true
+}
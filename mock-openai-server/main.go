@@ -4,35 +4,113 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 var (
-	port       = flag.Int("port", 8888, "Port to listen on")
-	fixedDelay = flag.Duration("delay", 0, "delay the response by this duration")
+	port             = flag.Int("port", 8888, "Port to listen on")
+	fixedDelay       = flag.Duration("delay", 0, "delay the response by this duration")
+	ignoreDisconnect = flag.Bool("ignore-disconnect", false, "keep generating (and charging) streams after the client disconnects")
+	modelNames       = flag.String("models", "gpt-3.5-turbo,gpt-4o,gpt-4o-mini", "Comma-separated model names served by /models")
 )
 
 type ChatCompletionRequest struct {
-	Model            string    `json:"model"`
-	Messages         []Message `json:"messages"`
-	Stream           bool      `json:"stream,omitempty"`
-	MaxTokens        int       `json:"max_tokens,omitempty"`
-	Temperature      float64   `json:"temperature,omitempty"`
-	TopP             float64   `json:"top_p,omitempty"`
-	N                int       `json:"n,omitempty"`
-	Stop             []string  `json:"stop,omitempty"`
-	PresencePenalty  float64   `json:"presence_penalty,omitempty"`
-	FrequencyPenalty float64   `json:"frequency_penalty,omitempty"`
-	User             string    `json:"user,omitempty"`
+	Model            string           `json:"model"`
+	Messages         []RequestMessage `json:"messages"`
+	Tools            []Tool           `json:"tools,omitempty"`
+	ToolChoice       interface{}      `json:"tool_choice,omitempty"` // "auto", "none", "required" or {"type":"function","function":{"name":...}}
+	Stream           bool             `json:"stream,omitempty"`
+	MaxTokens        int              `json:"max_tokens,omitempty"`
+	Temperature      float64          `json:"temperature,omitempty"`
+	TopP             float64          `json:"top_p,omitempty"`
+	N                int              `json:"n,omitempty"`
+	Stop             []string         `json:"stop,omitempty"`
+	PresencePenalty  float64          `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float64          `json:"frequency_penalty,omitempty"`
+	User             string           `json:"user,omitempty"`
+	StreamOptions    *struct {
+		IncludeUsage bool `json:"include_usage,omitempty"`
+	} `json:"stream_options,omitempty"`
 }
 
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role             string     `json:"role,omitempty"`
+	Content          string     `json:"content"`
+	ReasoningContent string     `json:"reasoning_content,omitempty"`
+	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// RequestMessage is a message as clients send it; content is a string or an
+// array of parts.
+type RequestMessage struct {
+	Role       string         `json:"role"`
+	Content    MessageContent `json:"content"`
+	Name       string         `json:"name,omitempty"`
+	ToolCalls  []ToolCall     `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type MessageContent struct {
+	Text  string
+	Parts []ContentPart
+}
+
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL    string `json:"url"`
+		Detail string `json:"detail,omitempty"`
+	} `json:"image_url,omitempty"`
+}
+
+func (c *MessageContent) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(b, &c.Text); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, &c.Parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of parts")
+	}
+	var texts []string
+	for _, p := range c.Parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	c.Text = strings.Join(texts, "\n")
+	return nil
+}
+
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+type FunctionDefinition struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"` // streamed deltas only
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
 }
 
 type ChatCompletionResponse struct {
@@ -62,6 +140,7 @@ type ChatCompletionChunk struct {
 	Created int64         `json:"created"`
 	Model   string        `json:"model"`
 	Choices []ChunkChoice `json:"choices"`
+	Usage   *Usage        `json:"usage,omitempty"`
 }
 
 type ChunkChoice struct {
@@ -70,10 +149,24 @@ type ChunkChoice struct {
 	FinishReason *string `json:"finish_reason,omitempty"`
 }
 
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type ModelList struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
 type ErrorResponse struct {
 	Error struct {
-		Message string `json:"message"`
-		Code    string `json:"code"`
+		Message string  `json:"message"`
+		Type    string  `json:"type"`
+		Param   *string `json:"param"`
+		Code    *string `json:"code"`
 	} `json:"error"`
 }
 
@@ -81,6 +174,16 @@ func parseDelay(delayStr string) (time.Duration, error) {
 	return time.ParseDuration(strings.ToLower(delayStr))
 }
 
+// requestDelay reads ?delay, falling back to -delay.
+func requestDelay(r *http.Request) (time.Duration, error) {
+	if delayStr := r.URL.Query().Get("delay"); delayStr != "" {
+		return parseDelay(delayStr)
+	}
+	return *fixedDelay, nil
+}
+
+var startTime = time.Now()
+
 var ErrorModels = map[int]string{
 	400: "Your credit balance is too low to access the API",
 	403: "Your account has an outstanding balance. Please settle it to regain access.",
@@ -89,23 +192,81 @@ var ErrorModels = map[int]string{
 	503: "The server is currently unavailable",
 }
 
+// openAIErrors are the type and code OpenAI sends for a status. Other 4xx
+// statuses are invalid_request_error and 5xx server_error, without a code.
+var openAIErrors = map[int]struct{ typ, code string }{
+	401: {"invalid_request_error", "invalid_api_key"},
+	403: {"permission_error", ""},
+	404: {"invalid_request_error", "model_not_found"},
+	429: {"rate_limit_exceeded", "rate_limit_exceeded"},
+}
+
 func MapError(code int, errMsg string) ErrorResponse {
-	var codeStr = strconv.Itoa(code)
-	if code >= 400 && code < 500 {
-		codeStr = "rate_limit_exceeded"
-	}
-	if code >= 500 {
-		codeStr = "server_error"
-	}
-	return ErrorResponse{
-		Error: struct {
-			Message string `json:"message"`
-			Code    string `json:"code"`
-		}{
-			Message: errMsg,
-			Code:    codeStr,
-		},
+	var resp ErrorResponse
+	resp.Error.Message = errMsg
+	resp.Error.Type = "server_error"
+	if code < 500 {
+		resp.Error.Type = "invalid_request_error"
 	}
+	if e, ok := openAIErrors[code]; ok {
+		resp.Error.Type = e.typ
+		if e.code != "" {
+			resp.Error.Code = stringPtr(e.code)
+		}
+	}
+	return resp
+}
+
+// errorModelError is the error of a numeric error model. The 429 model
+// reports an exhausted quota, which clients must not retry, rather than a
+// rate limit.
+func errorModelError(code int) ErrorResponse {
+	resp := MapError(code, ErrorModels[code])
+	if code == http.StatusTooManyRequests {
+		resp.Error.Type = "insufficient_quota"
+		resp.Error.Code = stringPtr("insufficient_quota")
+	}
+	return resp
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(MapError(status, message))
+}
+
+// KnownModels returns the configured model names. The numeric error models
+// are left out so that clients running every listed model expect success.
+func KnownModels() []string {
+	var names []string
+	for _, name := range strings.Split(*modelNames, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Printf("Request received - RemoteAddr: %s, Method: %s, URL: %s", r.RemoteAddr, r.Method, r.URL.String())
+
+	list := ModelList{Object: "list"}
+	for _, name := range KnownModels() {
+		list.Data = append(list.Data, Model{
+			ID:      name,
+			Object:  "model",
+			Created: startTime.Unix(),
+			OwnedBy: "mock-openai-server",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
 }
 
 func handleChatCompletions(w http.ResponseWriter, r *http.Request) {
@@ -114,23 +275,20 @@ func handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse delay from query parameter
-	delayStr := r.URL.Query().Get("delay")
-	var delay time.Duration
-	var err error
-	if delayStr != "" {
-		delay, err = parseDelay(delayStr)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid delay format: %v", err), http.StatusBadRequest)
-			return
-		}
-	} else if *fixedDelay > 0 {
-		delay = *fixedDelay
+	delay, err := requestDelay(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid delay format: %v", err), http.StatusBadRequest)
+		return
 	}
 
 	// Parse request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
 	var req ChatCompletionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.Unmarshal(body, &req); err != nil {
 		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
 		return
 	}
@@ -139,10 +297,10 @@ func handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Request received - RemoteAddr: %s, Method: %s, URL: %s, Model: %s", r.RemoteAddr, r.Method, r.URL.String(), req.Model)
 
 	if code, err := strconv.Atoi(req.Model); err == nil {
-		if errMsg, ok := ErrorModels[code]; ok {
+		if _, ok := ErrorModels[code]; ok {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(code)
-			json.NewEncoder(w).Encode(MapError(code, errMsg))
+			json.NewEncoder(w).Encode(errorModelError(code))
 			return
 		}
 	}
@@ -152,20 +310,107 @@ func handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		req.Model = "gpt-3.5-turbo"
 	}
 
+	w, r, handled := applyFaults(w, r, apiChat, req.Model, writeOpenAIError)
+	if handled {
+		return
+	}
+
+	if err := checkToolMessages(req.Messages); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reply := replyFor(chatConversation(req, body))
+	if reply != nil && reply.Delay > 0 {
+		delay = reply.Delay
+	}
+
+	// Track the request so clients can inspect it via /debug/requests/{id}
+	requestID := newRequestID()
+	tracker.Start(requestID, req.Model, req.Stream)
+	w.Header().Set("X-Request-Id", requestID)
+
 	// Set default stream value
 	if req.Stream {
-		handleStreamingResponse(w, req, delay)
+		handleStreamingResponse(w, r, req, reply, requestID, delay)
 	} else {
-		handleNonStreamingResponse(w, req, delay)
+		handleNonStreamingResponse(w, req, reply, requestID, delay)
 	}
 }
 
-func handleNonStreamingResponse(w http.ResponseWriter, req ChatCompletionRequest, delay time.Duration) {
+// chatConversation extracts what scenarios match on from a chat request.
+func chatConversation(req ChatCompletionRequest, body []byte) *Conversation {
+	conv := &Conversation{Model: req.Model}
+	json.Unmarshal(body, &conv.Fields)
+	for _, m := range req.Messages {
+		conv.LastRole = m.Role
+		switch m.Role {
+		case "user":
+			conv.LastUser = m.Content.Text
+		case "assistant":
+			conv.Turn++
+		case "tool":
+			conv.LastToolResult = m.Content.Text
+		}
+	}
+	for _, t := range req.Tools {
+		conv.Tools = append(conv.Tools, ToolSpec{Name: t.Function.Name, Parameters: t.Function.Parameters})
+	}
+	switch choice := req.ToolChoice.(type) {
+	case string:
+		conv.ToolChoice = choice
+	case map[string]interface{}:
+		fn, _ := choice["function"].(map[string]interface{})
+		conv.ToolChoice, _ = fn["name"].(string)
+	}
+	return conv
+}
+
+// checkToolMessages enforces the tool protocol as OpenAI does: every tool
+// call of an assistant message must be answered by a tool message with its
+// id before the conversation goes on, and tool messages must answer a call.
+func checkToolMessages(msgs []RequestMessage) error {
+	pending := map[string]bool{}
+	for i, m := range msgs {
+		if m.Role == "tool" {
+			if !pending[m.ToolCallID] {
+				return fmt.Errorf("messages[%d]: tool message with tool_call_id %q must respond to a preceding assistant message with tool_calls", i, m.ToolCallID)
+			}
+			delete(pending, m.ToolCallID)
+			continue
+		}
+		if len(pending) > 0 {
+			ids := make([]string, 0, len(pending))
+			for id := range pending {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			return fmt.Errorf("messages[%d]: an assistant message with tool_calls must be followed by tool messages responding to each tool_call_id, missing %s", i, strings.Join(ids, ", "))
+		}
+		for _, tc := range m.ToolCalls {
+			pending[tc.ID] = true
+		}
+	}
+	return nil
+}
+
+// cannedReply is the response when no scenario matches.
+var cannedReply = Reply{
+	Content:          "This is a mock response from the OpenAI API server. The request was processed successfully.",
+	FinishReason:     "stop",
+	PromptTokens:     10,
+	CompletionTokens: 20,
+}
+
+func handleNonStreamingResponse(w http.ResponseWriter, req ChatCompletionRequest, reply *Reply, requestID string, delay time.Duration) {
 	// Sleep for the specified delay
 	if delay > 0 {
 		log.Printf("Non-streaming request: sleeping for %v", delay)
 		time.Sleep(delay)
 	}
+	if reply == nil {
+		reply = &cannedReply
+	}
 
 	// Create mock response
 	response := ChatCompletionResponse{
@@ -177,104 +422,156 @@ func handleNonStreamingResponse(w http.ResponseWriter, req ChatCompletionRequest
 			{
 				Index: 0,
 				Message: Message{
-					Role:    "assistant",
-					Content: "This is a mock response from the OpenAI API server. The request was processed successfully.",
+					Role:             "assistant",
+					Content:          reply.Content,
+					ReasoningContent: reply.Reasoning,
+					ToolCalls:        reply.ToolCalls,
 				},
-				FinishReason: "stop",
+				FinishReason: reply.FinishReason,
 			},
 		},
 		Usage: Usage{
-			PromptTokens:     10,
-			CompletionTokens: 20,
-			TotalTokens:      30,
+			PromptTokens:     reply.PromptTokens,
+			CompletionTokens: reply.CompletionTokens,
+			TotalTokens:      reply.PromptTokens + reply.CompletionTokens,
 		},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
+
+	tracker.Update(requestID, func(rec *RequestRecord) {
+		now := time.Now()
+		rec.FinishedAt = &now
+		rec.Completed = true
+		rec.CompletionTokensCharged = response.Usage.CompletionTokens
+		rec.CompletionTokensReceived = response.Usage.CompletionTokens
+	})
 }
 
-func handleStreamingResponse(w http.ResponseWriter, req ChatCompletionRequest, delay time.Duration) {
-	// Set headers for streaming
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Cache-Control")
+// streamStep is one chunk of a streamed response and the pause before it.
+type streamStep struct {
+	pause  time.Duration
+	delta  Message
+	finish *string
+}
 
-	// Create a flusher to ensure data is sent immediately
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+// cannedSteps sends the canned chunks 100ms apart and the final one after
+// the delay.
+func cannedSteps(delay time.Duration) []streamStep {
+	var steps []streamStep
+	for i, chunk := range []string{
+		"This is a mock",
+		" streaming response",
+		" from the OpenAI",
+		" API server. ",
+	} {
+		pause := 100 * time.Millisecond
+		if i == 0 {
+			pause = 0
+		}
+		steps = append(steps, streamStep{pause: pause, delta: Message{Role: "assistant", Content: chunk}})
+	}
+	return append(steps, streamStep{
+		pause:  100*time.Millisecond + delay,
+		delta:  Message{Role: "assistant", Content: "The request was processed successfully with the specified delay."},
+		finish: stringPtr("stop"),
+	})
+}
+
+// replySteps streams the content a few words at a time, then every tool call
+// as a header chunk followed by fragments of its arguments, the way OpenAI
+// does.
+func replySteps(reply *Reply, delay time.Duration) []streamStep {
+	pause := reply.ChunkDelay
+	if pause == 0 {
+		pause = 20 * time.Millisecond
+	}
+	steps := []streamStep{{pause: delay, delta: Message{Role: "assistant"}}}
+	for _, chunk := range textChunks(reply.Reasoning) {
+		steps = append(steps, streamStep{pause: pause, delta: Message{ReasoningContent: chunk}})
+	}
+	for _, chunk := range textChunks(reply.Content) {
+		steps = append(steps, streamStep{pause: pause, delta: Message{Content: chunk}})
+	}
+	for i, tc := range reply.ToolCalls {
+		index := i
+		steps = append(steps, streamStep{pause: pause, delta: Message{ToolCalls: []ToolCall{{
+			Index: &index, ID: tc.ID, Type: tc.Type, Function: FunctionCall{Name: tc.Function.Name},
+		}}}})
+		for _, frag := range argumentChunks(tc.Function.Arguments) {
+			steps = append(steps, streamStep{pause: pause, delta: Message{ToolCalls: []ToolCall{{
+				Index: &index, Function: FunctionCall{Arguments: frag},
+			}}}})
+		}
+	}
+	return append(steps, streamStep{pause: pause, finish: stringPtr(reply.FinishReason)})
+}
+
+func handleStreamingResponse(w http.ResponseWriter, r *http.Request, req ChatCompletionRequest, reply *Reply, requestID string, delay time.Duration) {
+	stream := newSSEStream(w, r, requestID, apiChat)
+	if stream == nil {
 		return
 	}
+	completed := false
+	defer func() { stream.finish(completed) }()
 
 	completionID := "chatcmpl-" + fmt.Sprintf("%d", time.Now().Unix())
 	created := time.Now().Unix()
 
-	// Send initial chunks immediately
-	chunks := []string{
-		"This is a mock",
-		" streaming response",
-		" from the OpenAI",
-		" API server. ",
+	steps := cannedSteps(delay)
+	if reply != nil {
+		steps = replySteps(reply, delay)
 	}
-
-	for _, chunk := range chunks {
-		chunkResponse := ChatCompletionChunk{
+	if delay > 0 {
+		log.Printf("Streaming request: delaying by %v", delay)
+	}
+	for _, step := range steps {
+		if !stream.wait(step.pause) || stream.disconnected() {
+			return
+		}
+		tokens := countTokens(step.delta.Content) + countTokens(step.delta.ReasoningContent)
+		for _, tc := range step.delta.ToolCalls {
+			tokens += countTokens(tc.Function.Arguments)
+		}
+		stream.send("", ChatCompletionChunk{
 			ID:      completionID,
 			Object:  "chat.completion.chunk",
 			Created: created,
 			Model:   req.Model,
 			Choices: []ChunkChoice{
 				{
-					Index: 0,
-					Delta: Message{
-						Role:    "assistant",
-						Content: chunk,
-					},
+					Index:        0,
+					Delta:        step.delta,
+					FinishReason: step.finish,
 				},
 			},
-		}
-
-		data, _ := json.Marshal(chunkResponse)
-		fmt.Fprintf(w, "data: %s\n\n", data)
-		flusher.Flush()
-
-		// Small delay between chunks
-		time.Sleep(100 * time.Millisecond)
+		}, tokens)
 	}
 
-	// Sleep for the specified delay
-	if delay > 0 {
-		log.Printf("Streaming request: sleeping for %v before final chunk", delay)
-		time.Sleep(delay)
-	}
-
-	// Send final chunk
-	finalChunk := ChatCompletionChunk{
-		ID:      completionID,
-		Object:  "chat.completion.chunk",
-		Created: created,
-		Model:   req.Model,
-		Choices: []ChunkChoice{
-			{
-				Index: 0,
-				Delta: Message{
-					Role:    "assistant",
-					Content: "The request was processed successfully with the specified delay.",
-				},
-				FinishReason: stringPtr("stop"),
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		promptTokens, completionTokens := 10, stream.tokens
+		if reply != nil {
+			promptTokens, completionTokens = reply.PromptTokens, reply.CompletionTokens
+		}
+		data, _ := json.Marshal(ChatCompletionChunk{
+			ID:      completionID,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   req.Model,
+			Choices: []ChunkChoice{},
+			Usage: &Usage{
+				PromptTokens:     promptTokens,
+				CompletionTokens: completionTokens,
+				TotalTokens:      promptTokens + completionTokens,
 			},
-		},
+		})
+		stream.raw(fmt.Sprintf("data: %s\n\n", data))
 	}
 
-	data, _ := json.Marshal(finalChunk)
-	fmt.Fprintf(w, "data: %s\n\n", data)
-
 	// Send done signal
-	fmt.Fprintf(w, "data: [DONE]\n\n")
-	flusher.Flush()
+	stream.raw("data: [DONE]\n\n")
+	completed = true
 }
 
 func stringPtr(s string) *string {
@@ -284,12 +581,37 @@ func stringPtr(s string) *string {
 func main() {
 	flag.Parse()
 
+	if *scenariosPath != "" {
+		var err error
+		if scenarios, err = loadScenarios(*scenariosPath); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Loaded %d scenarios from %s", len(scenarios), *scenariosPath)
+	}
+	if *faultsPath != "" {
+		var err error
+		if faultRules, err = loadFaults(*faultsPath); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Loaded %d fault rules from %s", len(faultRules), *faultsPath)
+	}
+
 	// Create mux for routing
 	mux := http.NewServeMux()
 
 	// Register handlers for both endpoints
 	mux.HandleFunc("/chat/completions", handleChatCompletions)
 	mux.HandleFunc("/v1/chat/completions", handleChatCompletions)
+	mux.HandleFunc("/models", handleModels)
+	mux.HandleFunc("/v1/models", handleModels)
+	mux.HandleFunc("/messages", handleMessages)
+	mux.HandleFunc("/v1/messages", handleMessages)
+	mux.HandleFunc("/responses", handleResponses)
+	mux.HandleFunc("/responses/", handleResponses)
+	mux.HandleFunc("/v1/responses", handleResponses)
+	mux.HandleFunc("/v1/responses/", handleResponses)
+	mux.HandleFunc("/debug/requests/", handleDebugRequest)
+	mux.HandleFunc("/v1/debug/requests/", handleDebugRequest)
 
 	// Add health check endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -302,11 +624,25 @@ func main() {
 
 	// Add root endpoint with usage information
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// Gemini paths vary by provider, so they are matched by suffix
+		if geminiPathRe.MatchString(r.URL.Path) {
+			handleGemini(w, r)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"endpoints": map[string]string{
 				"chat_completions":    "POST /chat/completions",
 				"v1_chat_completions": "POST /v1/chat/completions",
+				"models":              "GET /models",
+				"v1_models":           "GET /v1/models",
+				"messages":            "POST /messages",
+				"v1_messages":         "POST /v1/messages",
+				"responses":           "POST /responses",
+				"v1_responses":        "POST /v1/responses",
+				"gemini":              "POST /v1beta/models/{model}:generateContent",
+				"gemini_stream":       "POST /v1beta/models/{model}:streamGenerateContent[?alt=sse]",
+				"debug_requests":      "GET /debug/requests/{id}",
 				"health":              "GET /health",
 			},
 			"delay": "?delay=<duration>",
@@ -318,6 +654,16 @@ func main() {
 	log.Printf("Available endpoints:")
 	log.Printf("  POST /chat/completions")
 	log.Printf("  POST /v1/chat/completions")
+	log.Printf("  GET  /models")
+	log.Printf("  GET  /v1/models")
+	log.Printf("  POST /messages")
+	log.Printf("  POST /v1/messages")
+	log.Printf("  POST /responses")
+	log.Printf("  POST /v1/responses")
+	log.Printf("  GET  /v1/responses/{id}")
+	log.Printf("  POST .../models/{model}:generateContent")
+	log.Printf("  POST .../models/{model}:streamGenerateContent[?alt=sse]")
+	log.Printf("  GET  /debug/requests/{id}")
 	log.Printf("  GET  /health")
 	log.Printf("  GET  /")
 	log.Printf("Use ?delay=5s to add delays")
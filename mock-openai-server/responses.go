@@ -0,0 +1,597 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxStoredResponses bounds how many responses are kept for
+// previous_response_id and GET /responses/{id}.
+const maxStoredResponses = 1000
+
+// ResponsesRequest is an OpenAI Responses API request.
+type ResponsesRequest struct {
+	Model        string          `json:"model"`
+	Input        ResponsesInput  `json:"input"`
+	Instructions string          `json:"instructions,omitempty"`
+	Tools        []ResponsesTool `json:"tools,omitempty"`
+	ToolChoice   interface{}     `json:"tool_choice,omitempty"` // "auto", "none", "required" or {"type":"function","name":...}
+	Reasoning    *struct {
+		Effort  string `json:"effort,omitempty"`
+		Summary string `json:"summary,omitempty"`
+	} `json:"reasoning,omitempty"`
+	MaxOutputTokens    int    `json:"max_output_tokens,omitempty"`
+	PreviousResponseID string `json:"previous_response_id,omitempty"`
+	Store              *bool  `json:"store,omitempty"`
+	Stream             bool   `json:"stream,omitempty"`
+}
+
+// ResponsesInput is a string or an array of input items.
+type ResponsesInput []ResponsesItem
+
+func (in *ResponsesInput) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		*in = ResponsesInput{{Type: "message", Role: "user", Content: &MessageContent{Text: text}}}
+		return nil
+	}
+	var items []ResponsesItem
+	if err := json.Unmarshal(b, &items); err != nil {
+		return fmt.Errorf("input must be a string or an array of items")
+	}
+	*in = items
+	return nil
+}
+
+// ResponsesItem is an input or output item: a message, a function call, a
+// function call output or a reasoning item.
+type ResponsesItem struct {
+	ID        string          `json:"id,omitempty"`
+	Type      string          `json:"type,omitempty"` // "message" when omitted
+	Status    string          `json:"status,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   *MessageContent `json:"-"`
+	CallID    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"` // a string or content parts
+}
+
+func (it *ResponsesItem) UnmarshalJSON(b []byte) error {
+	type plain ResponsesItem
+	var aux struct {
+		plain
+		Content *MessageContent `json:"content"`
+	}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	*it = ResponsesItem(aux.plain)
+	it.Content = aux.Content
+	if it.Type == "" {
+		it.Type = "message"
+	}
+	return nil
+}
+
+// text joins the text of a message's content, whatever the part types.
+func (it *ResponsesItem) text() string {
+	if it.Content == nil {
+		return ""
+	}
+	if len(it.Content.Parts) == 0 {
+		return it.Content.Text
+	}
+	var texts []string
+	for _, p := range it.Content.Parts {
+		switch p.Type {
+		case "input_text", "output_text", "text":
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// outputText is the output of a function_call_output item as text.
+func (it *ResponsesItem) outputText() string {
+	var s string
+	if json.Unmarshal(it.Output, &s) == nil {
+		return s
+	}
+	return string(it.Output)
+}
+
+type ResponsesTool struct {
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// ResponseObject is a response as returned and as streamed in the
+// response.created and response.completed events.
+type ResponseObject struct {
+	ID                 string            `json:"id"`
+	Object             string            `json:"object"`
+	CreatedAt          int64             `json:"created_at"`
+	Status             string            `json:"status"`
+	Model              string            `json:"model"`
+	Output             []interface{}     `json:"output"`
+	PreviousResponseID *string           `json:"previous_response_id"`
+	IncompleteDetails  map[string]string `json:"incomplete_details"`
+	Error              interface{}       `json:"error"`
+	Usage              *ResponsesUsage   `json:"usage"`
+}
+
+type ResponsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+	TotalTokens int `json:"total_tokens"`
+}
+
+var responsesCannedReply = Reply{
+	Content:          "This is a mock response from the Responses API. The request was processed successfully.",
+	FinishReason:     "stop",
+	PromptTokens:     10,
+	CompletionTokens: 20,
+}
+
+// storedResponse keeps what later requests need: the whole conversation,
+// including the response's own output, and the response itself.
+type storedResponse struct {
+	items    []ResponsesItem
+	response ResponseObject
+}
+
+type responseStore struct {
+	mu        sync.Mutex
+	responses map[string]*storedResponse
+	order     []string
+}
+
+var responses = &responseStore{responses: make(map[string]*storedResponse)}
+
+var itemCounter uint64
+
+func newItemID(prefix string) string {
+	return fmt.Sprintf("%s_mock%d", prefix, atomic.AddUint64(&itemCounter, 1))
+}
+
+func (s *responseStore) Get(id string) *storedResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.responses[id]
+}
+
+func (s *responseStore) Put(id string, sr *storedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[id] = sr
+	s.order = append(s.order, id)
+	if len(s.order) > maxStoredResponses {
+		delete(s.responses, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// writeResponsesError sends an invalid_request_error; empty param and code
+// are sent as null.
+func writeResponsesError(w http.ResponseWriter, status int, message, param, code string) {
+	orNull := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    "invalid_request_error",
+			"param":   orNull(param),
+			"code":    orNull(code),
+		},
+	})
+}
+
+// handleResponses serves POST /responses and GET /responses/{id}.
+func handleResponses(w http.ResponseWriter, r *http.Request) {
+	if _, id, ok := strings.Cut(r.URL.Path, "/responses/"); ok && id != "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		sr := responses.Get(id)
+		if sr == nil {
+			writeResponsesError(w, http.StatusNotFound, fmt.Sprintf("Response with id '%s' not found.", id), "", "")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sr.response)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	delay, err := requestDelay(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid delay format: %v", err), http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	var req ResponsesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeResponsesError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err), "", "")
+		return
+	}
+
+	log.Printf("Request received - RemoteAddr: %s, Method: %s, URL: %s, Model: %s", r.RemoteAddr, r.Method, r.URL.String(), req.Model)
+
+	if code, err := strconv.Atoi(req.Model); err == nil {
+		if _, ok := ErrorModels[code]; ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(errorModelError(code))
+			return
+		}
+	}
+	if req.Model == "" {
+		writeResponsesError(w, http.StatusBadRequest, "Missing required parameter: 'model'.", "model", "missing_required_parameter")
+		return
+	}
+	w, r, handled := applyFaults(w, r, apiResponses, req.Model, writeOpenAIError)
+	if handled {
+		return
+	}
+
+	// The conversation is the previous response's, followed by the input.
+	var items []ResponsesItem
+	if req.PreviousResponseID != "" {
+		prev := responses.Get(req.PreviousResponseID)
+		if prev == nil {
+			writeResponsesError(w, http.StatusBadRequest, fmt.Sprintf("Previous response with id '%s' not found.", req.PreviousResponseID), "previous_response_id", "previous_response_not_found")
+			return
+		}
+		items = append(items, prev.items...)
+	}
+	items = append(items, req.Input...)
+	if len(items) == 0 {
+		writeResponsesError(w, http.StatusBadRequest, "Missing required parameter: 'input'.", "input", "missing_required_parameter")
+		return
+	}
+	if err := checkFunctionCallOutputs(items); err != nil {
+		writeResponsesError(w, http.StatusBadRequest, err.Error(), "input", "")
+		return
+	}
+
+	reply := replyFor(responsesConversation(req, items, body))
+	if reply == nil {
+		canned := responsesCannedReply
+		reply = &canned
+	}
+	if reply.Delay > 0 {
+		delay = reply.Delay
+	}
+	if req.Reasoning != nil && reply.Reasoning == "" {
+		reply.Reasoning = "The user sent a request to the mock server. I will answer with the scripted response."
+	}
+
+	requestID := newRequestID()
+	tracker.Start(requestID, req.Model, req.Stream)
+	w.Header().Set("X-Request-Id", requestID)
+
+	resp := ResponseObject{
+		ID:        newItemID("resp"),
+		Object:    "response",
+		CreatedAt: time.Now().Unix(),
+		Status:    "in_progress",
+		Model:     req.Model,
+		Output:    []interface{}{},
+	}
+	if req.PreviousResponseID != "" {
+		resp.PreviousResponseID = &req.PreviousResponseID
+	}
+	output := responsesOutput(reply)
+
+	completed := false
+	if req.Stream {
+		completed = streamResponses(w, r, resp, output, reply, requestID, delay)
+	} else {
+		if delay > 0 {
+			log.Printf("Non-streaming request: sleeping for %v", delay)
+			time.Sleep(delay)
+		}
+		resp = completeResponse(resp, output, reply)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		completed = true
+
+		tracker.Update(requestID, func(rec *RequestRecord) {
+			now := time.Now()
+			rec.FinishedAt = &now
+			rec.Completed = true
+			rec.CompletionTokensCharged = reply.CompletionTokens
+			rec.CompletionTokensReceived = reply.CompletionTokens
+		})
+	}
+
+	if completed && (req.Store == nil || *req.Store) {
+		for _, it := range output {
+			if it.Type != "reasoning" {
+				items = append(items, it.ResponsesItem)
+			}
+		}
+		responses.Put(resp.ID, &storedResponse{items: items, response: completeResponse(resp, output, reply)})
+	}
+}
+
+// checkFunctionCallOutputs applies the API's pairing rules: every
+// function_call_output answers an earlier function_call, and every call is
+// answered.
+func checkFunctionCallOutputs(items []ResponsesItem) error {
+	pending := map[string]bool{}
+	var order []string
+	for _, it := range items {
+		switch it.Type {
+		case "function_call":
+			pending[it.CallID] = true
+			order = append(order, it.CallID)
+		case "function_call_output":
+			if !pending[it.CallID] {
+				return fmt.Errorf("No tool call found for function call output with call_id %s.", it.CallID)
+			}
+			delete(pending, it.CallID)
+		}
+	}
+	for _, id := range order {
+		if pending[id] {
+			return fmt.Errorf("No tool output found for function call %s.", id)
+		}
+	}
+	return nil
+}
+
+// responsesConversation extracts what scenarios match on. Consecutive
+// assistant items (reasoning, messages and function calls) make one turn.
+func responsesConversation(req ResponsesRequest, items []ResponsesItem, body []byte) *Conversation {
+	conv := &Conversation{Model: req.Model}
+	json.Unmarshal(body, &conv.Fields)
+	var results []string
+	for _, it := range items {
+		assistant := it.Type == "function_call" || it.Type == "reasoning" || (it.Type == "message" && it.Role == "assistant")
+		if assistant && conv.LastRole != "assistant" {
+			conv.Turn++
+		}
+		switch {
+		case assistant:
+			conv.LastRole = "assistant"
+		case it.Type == "function_call_output":
+			if conv.LastRole != "tool" {
+				results = nil
+			}
+			results = append(results, it.outputText())
+			conv.LastRole = "tool"
+			conv.LastToolResult = strings.Join(results, "\n")
+		case it.Type == "message":
+			conv.LastRole = it.Role
+			if it.Role == "user" {
+				conv.LastUser = it.text()
+			}
+		}
+	}
+	for _, t := range req.Tools {
+		if t.Type == "function" {
+			conv.Tools = append(conv.Tools, ToolSpec{Name: t.Name, Parameters: t.Parameters})
+		}
+	}
+	switch tc := req.ToolChoice.(type) {
+	case string:
+		conv.ToolChoice = tc
+	case map[string]interface{}:
+		if name, ok := tc["name"].(string); ok {
+			conv.ToolChoice = name
+		}
+	}
+	return conv
+}
+
+// outputItem is an output item with its content as sent to clients.
+type outputItem struct {
+	ResponsesItem
+	Summary []map[string]string
+	Parts   []map[string]interface{}
+	text    string
+}
+
+func (it outputItem) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{"id": it.ID, "type": it.Type}
+	switch it.Type {
+	case "reasoning":
+		m["summary"] = it.Summary
+	case "message":
+		m["status"], m["role"], m["content"] = it.Status, it.Role, it.Parts
+	case "function_call":
+		m["status"], m["call_id"], m["name"], m["arguments"] = it.Status, it.CallID, it.Name, it.Arguments
+	}
+	return json.Marshal(m)
+}
+
+// responsesOutput renders reply as reasoning, message and function_call
+// output items.
+func responsesOutput(reply *Reply) []outputItem {
+	var out []outputItem
+	if reply.Reasoning != "" {
+		out = append(out, outputItem{
+			ResponsesItem: ResponsesItem{ID: newItemID("rs"), Type: "reasoning"},
+			Summary:       []map[string]string{{"type": "summary_text", "text": reply.Reasoning}},
+			text:          reply.Reasoning,
+		})
+	}
+	if reply.Content != "" {
+		out = append(out, outputItem{
+			ResponsesItem: ResponsesItem{
+				ID: newItemID("msg"), Type: "message", Status: "completed", Role: "assistant",
+				Content: &MessageContent{Text: reply.Content, Parts: []ContentPart{{Type: "output_text", Text: reply.Content}}},
+			},
+			Parts: []map[string]interface{}{{"type": "output_text", "text": reply.Content, "annotations": []interface{}{}}},
+			text:  reply.Content,
+		})
+	}
+	for _, tc := range reply.ToolCalls {
+		out = append(out, outputItem{
+			ResponsesItem: ResponsesItem{
+				ID: newItemID("fc"), Type: "function_call", Status: "completed",
+				CallID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments,
+			},
+		})
+	}
+	return out
+}
+
+// completeResponse fills in the output, status and usage of resp.
+func completeResponse(resp ResponseObject, output []outputItem, reply *Reply) ResponseObject {
+	resp.Status = "completed"
+	resp.Output = make([]interface{}, len(output))
+	for i, it := range output {
+		resp.Output[i] = it
+	}
+	if reply.FinishReason == "length" {
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = map[string]string{"reason": "max_output_tokens"}
+	}
+	usage := &ResponsesUsage{InputTokens: reply.PromptTokens, OutputTokens: reply.CompletionTokens}
+	usage.OutputTokensDetails.ReasoningTokens = countTokens(reply.Reasoning)
+	usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	resp.Usage = usage
+	return resp
+}
+
+// streamResponses sends the Responses API event sequence: response.created
+// and response.in_progress, then for every output item output_item.added,
+// its part and delta events and output_item.done, and finally
+// response.completed. It reports whether the stream ran to the end.
+func streamResponses(w http.ResponseWriter, r *http.Request, resp ResponseObject, output []outputItem, reply *Reply, requestID string, delay time.Duration) bool {
+	stream := newSSEStream(w, r, requestID, apiResponses)
+	if stream == nil {
+		return false
+	}
+	completed := false
+	defer func() { stream.finish(completed) }()
+
+	seq := 0
+	send := func(typ string, fields map[string]interface{}, tokens int) {
+		fields["type"] = typ
+		fields["sequence_number"] = seq
+		seq++
+		stream.send(typ, fields, tokens)
+	}
+	pause := reply.ChunkDelay
+	if pause == 0 {
+		pause = 20 * time.Millisecond
+	}
+	next := func(d time.Duration) bool {
+		return stream.wait(d) && !stream.disconnected()
+	}
+
+	send("response.created", map[string]interface{}{"response": resp}, 0)
+	send("response.in_progress", map[string]interface{}{"response": resp}, 0)
+	if delay > 0 {
+		log.Printf("Streaming request: delaying by %v", delay)
+	}
+	if !next(delay) {
+		return false
+	}
+
+	for i, it := range output {
+		started := it
+		started.Status = "in_progress"
+		switch it.Type {
+		case "reasoning":
+			started.Summary = []map[string]string{}
+		case "message":
+			started.Parts = []map[string]interface{}{}
+		case "function_call":
+			started.Arguments = ""
+		}
+		send("response.output_item.added", map[string]interface{}{"output_index": i, "item": started}, 0)
+
+		ids := map[string]interface{}{"item_id": it.ID, "output_index": i}
+		with := func(extra map[string]interface{}) map[string]interface{} {
+			m := map[string]interface{}{}
+			for k, v := range ids {
+				m[k] = v
+			}
+			for k, v := range extra {
+				m[k] = v
+			}
+			return m
+		}
+		switch it.Type {
+		case "reasoning":
+			part := map[string]string{"type": "summary_text", "text": ""}
+			send("response.reasoning_summary_part.added", with(map[string]interface{}{"summary_index": 0, "part": part}), 0)
+			for _, chunk := range textChunks(it.text) {
+				if !next(pause) {
+					return false
+				}
+				send("response.reasoning_summary_text.delta", with(map[string]interface{}{"summary_index": 0, "delta": chunk}), 0)
+			}
+			send("response.reasoning_summary_text.done", with(map[string]interface{}{"summary_index": 0, "text": it.text}), 0)
+			part["text"] = it.text
+			send("response.reasoning_summary_part.done", with(map[string]interface{}{"summary_index": 0, "part": part}), 0)
+		case "message":
+			part := map[string]interface{}{"type": "output_text", "text": "", "annotations": []interface{}{}}
+			send("response.content_part.added", with(map[string]interface{}{"content_index": 0, "part": part}), 0)
+			for _, chunk := range textChunks(it.text) {
+				if !next(pause) {
+					return false
+				}
+				send("response.output_text.delta", with(map[string]interface{}{"content_index": 0, "delta": chunk}), countTokens(chunk))
+			}
+			send("response.output_text.done", with(map[string]interface{}{"content_index": 0, "text": it.text}), 0)
+			send("response.content_part.done", with(map[string]interface{}{"content_index": 0, "part": it.Parts[0]}), 0)
+		case "function_call":
+			for _, frag := range argumentChunks(it.Arguments) {
+				if !next(pause) {
+					return false
+				}
+				send("response.function_call_arguments.delta", with(map[string]interface{}{"delta": frag}), countTokens(frag))
+			}
+			send("response.function_call_arguments.done", with(map[string]interface{}{"arguments": it.Arguments}), 0)
+		}
+		send("response.output_item.done", map[string]interface{}{"output_index": i, "item": it}, 0)
+	}
+
+	if !next(pause) {
+		return false
+	}
+	final := completeResponse(resp, output, reply)
+	event := "response.completed"
+	if final.Status == "incomplete" {
+		event = "response.incomplete"
+	}
+	send(event, map[string]interface{}{"response": final}, 0)
+	completed = !stream.failed // a fault can replace the final event too
+	return completed
+}
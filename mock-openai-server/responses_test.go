@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCheckFunctionCallOutputs(t *testing.T) {
+	tests := []struct {
+		name  string
+		items string
+		want  string // error, empty for valid
+	}{
+		{"no calls", `[{"role":"user","content":"hi"}]`, ""},
+		{"answered", `[{"role":"user","content":"hi"},
+			{"type":"function_call","call_id":"c1","name":"f","arguments":"{}"},
+			{"type":"function_call","call_id":"c2","name":"f","arguments":"{}"},
+			{"type":"function_call_output","call_id":"c2","output":"a"},
+			{"type":"function_call_output","call_id":"c1","output":"b"}]`, ""},
+		{"output without call", `[{"type":"function_call_output","call_id":"c9","output":"a"}]`,
+			"No tool call found for function call output with call_id c9."},
+		{"output before call", `[{"type":"function_call_output","call_id":"c1","output":"a"},
+			{"type":"function_call","call_id":"c1","name":"f","arguments":"{}"}]`,
+			"No tool call found for function call output with call_id c1."},
+		{"answered twice", `[{"type":"function_call","call_id":"c1","name":"f","arguments":"{}"},
+			{"type":"function_call_output","call_id":"c1","output":"a"},
+			{"type":"function_call_output","call_id":"c1","output":"a"}]`,
+			"No tool call found for function call output with call_id c1."},
+		{"first unanswered call reported", `[{"type":"function_call","call_id":"c1","name":"f","arguments":"{}"},
+			{"type":"function_call","call_id":"c2","name":"f","arguments":"{}"},
+			{"type":"function_call","call_id":"c3","name":"f","arguments":"{}"},
+			{"type":"function_call_output","call_id":"c1","output":"a"}]`,
+			"No tool output found for function call c2."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var items []ResponsesItem
+			if err := json.Unmarshal([]byte(tt.items), &items); err != nil {
+				t.Fatal(err)
+			}
+			err := checkFunctionCallOutputs(items)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("err = %v, want nil", err)
+			case tt.want != "" && (err == nil || err.Error() != tt.want):
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
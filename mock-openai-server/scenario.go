@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var scenariosPath = flag.String("scenarios", "", "YAML/JSON scenario file, or a directory of them, with scripted responses")
+
+// Scenario answers matching requests with scripted responses. Responses are
+// picked by turn: a request whose conversation already holds n assistant
+// messages gets Responses[n], and the last response repeats once the script
+// runs out. That keeps multi-round tool flows working without server state
+// shared between clients.
+type Scenario struct {
+	Name      string             `yaml:"name"`
+	Match     ScenarioMatch      `yaml:"match"`
+	Responses []ScriptedResponse `yaml:"responses"`
+}
+
+// ScenarioMatch conditions must all hold; empty ones are ignored.
+type ScenarioMatch struct {
+	Model    string                 `yaml:"model"`     // glob, e.g. "gpt-4o*"
+	LastUser string                 `yaml:"last_user"` // regular expression against the last user message
+	LastRole string                 `yaml:"last_role"` // role of the last message, e.g. "tool"
+	Fields   map[string]interface{} `yaml:"fields"`    // dotted request paths, e.g. "tools.0.function.name", and their values
+
+	lastUser *regexp.Regexp
+}
+
+// ScriptedResponse is one assistant turn.
+type ScriptedResponse struct {
+	Content          string             `yaml:"content"`
+	Reasoning        string             `yaml:"reasoning"` // reasoning_content, thinking blocks or thought parts
+	ToolCalls        []ScriptedToolCall `yaml:"tool_calls"`
+	FinishReason     string             `yaml:"finish_reason"` // default "tool_calls" with tool calls, else "stop"
+	PromptTokens     int                `yaml:"prompt_tokens"`
+	CompletionTokens int                `yaml:"completion_tokens"`
+	Delay            time.Duration      `yaml:"delay"`       // before the response, instead of ?delay
+	ChunkDelay       time.Duration      `yaml:"chunk_delay"` // between streamed chunks
+}
+
+type ScriptedToolCall struct {
+	ID        string      `yaml:"id"`
+	Name      string      `yaml:"name"`
+	Arguments interface{} `yaml:"arguments"` // an object, or a JSON string sent verbatim
+}
+
+// Conversation is what scenarios match against, extracted from a request of
+// any supported API.
+type Conversation struct {
+	Model          string
+	LastUser       string
+	LastRole       string // "tool" when the last message carries tool results
+	LastToolResult string
+	Turn           int // assistant messages already in the conversation
+	Tools          []ToolSpec
+	ToolChoice     string // "auto", "none", "required" or a function name
+	Fields         map[string]interface{}
+}
+
+// Reply is an assistant turn independent of the API it is rendered for.
+type Reply struct {
+	Content          string
+	Reasoning        string
+	ToolCalls        []ToolCall
+	FinishReason     string
+	PromptTokens     int
+	CompletionTokens int
+	Delay            time.Duration
+	ChunkDelay       time.Duration
+}
+
+var scenarios []Scenario
+
+// loadScenarios reads p, or every .yaml, .yml and .json file in it when it
+// is a directory, in name order.
+func loadScenarios(p string) ([]Scenario, error) {
+	files := []string{p}
+	if info, err := os.Stat(p); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		files = nil
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			switch filepath.Ext(e.Name()) {
+			case ".yaml", ".yml", ".json":
+				files = append(files, filepath.Join(p, e.Name()))
+			}
+		}
+		sort.Strings(files)
+	}
+
+	var all []Scenario
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var file struct {
+			Scenarios []Scenario `yaml:"scenarios"`
+		}
+		if err := yaml.Unmarshal(data, &file); err != nil { // YAML is a superset of JSON
+			return nil, fmt.Errorf("failed to parse %s: %w", f, err)
+		}
+		for i := range file.Scenarios {
+			sc := &file.Scenarios[i]
+			if err := sc.validate(); err != nil {
+				return nil, fmt.Errorf("%s: scenarios[%d] %s: %w", f, i, sc.Name, err)
+			}
+		}
+		all = append(all, file.Scenarios...)
+	}
+	return all, nil
+}
+
+func (sc *Scenario) validate() error {
+	if len(sc.Responses) == 0 {
+		return fmt.Errorf("no responses")
+	}
+	if _, err := path.Match(sc.Match.Model, ""); err != nil {
+		return fmt.Errorf("model: %w", err)
+	}
+	if sc.Match.LastUser != "" {
+		re, err := regexp.Compile(sc.Match.LastUser)
+		if err != nil {
+			return fmt.Errorf("last_user: %w", err)
+		}
+		sc.Match.lastUser = re
+	}
+	for i, resp := range sc.Responses {
+		for j, tc := range resp.ToolCalls {
+			if tc.Name == "" {
+				return fmt.Errorf("responses[%d].tool_calls[%d]: name is required", i, j)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *ScenarioMatch) matches(conv *Conversation) bool {
+	if m.Model != "" {
+		if ok, _ := path.Match(m.Model, conv.Model); !ok {
+			return false
+		}
+	}
+	if m.lastUser != nil && !m.lastUser.MatchString(conv.LastUser) {
+		return false
+	}
+	if m.LastRole != "" && m.LastRole != conv.LastRole {
+		return false
+	}
+	for p, want := range m.Fields {
+		got, ok := lookupField(conv.Fields, p)
+		if !ok || !sameJSON(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupField follows a dotted path through JSON objects and arrays.
+func lookupField(v interface{}, p string) (interface{}, bool) {
+	for _, key := range strings.Split(p, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// sameJSON compares values decoded from YAML and from JSON, whose number
+// types differ.
+func sameJSON(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// scriptedReply returns the reply of the first scenario matching conv, or
+// nil to fall back to the canned response.
+func scriptedReply(conv *Conversation) (*Reply, string) {
+	for i := range scenarios {
+		sc := &scenarios[i]
+		if !sc.Match.matches(conv) {
+			continue
+		}
+		resp := sc.Responses[len(sc.Responses)-1]
+		if conv.Turn < len(sc.Responses) {
+			resp = sc.Responses[conv.Turn]
+		}
+		return resp.reply(), sc.Name
+	}
+	return nil, ""
+}
+
+// replyFor picks the reply to conv: a scenario's, else a generated tool call
+// or tool answer, else nil for the API's canned response.
+func replyFor(conv *Conversation) *Reply {
+	if reply, name := scriptedReply(conv); reply != nil {
+		log.Printf("Scenario %q, turn %d", name, conv.Turn)
+		return reply
+	}
+	reply := toolReply(conv)
+	if reply != nil && len(reply.ToolCalls) > 0 {
+		log.Printf("Calling tool %s", reply.ToolCalls[0].Function.Name)
+	}
+	return reply
+}
+
+func (resp ScriptedResponse) reply() *Reply {
+	rep := &Reply{
+		Content:          resp.Content,
+		Reasoning:        resp.Reasoning,
+		FinishReason:     resp.FinishReason,
+		PromptTokens:     resp.PromptTokens,
+		CompletionTokens: resp.CompletionTokens,
+		Delay:            resp.Delay,
+		ChunkDelay:       resp.ChunkDelay,
+	}
+	for i, tc := range resp.ToolCalls {
+		args, ok := tc.Arguments.(string)
+		if !ok {
+			if tc.Arguments == nil {
+				tc.Arguments = map[string]interface{}{}
+			}
+			b, _ := json.Marshal(tc.Arguments)
+			args = string(b)
+		}
+		id := tc.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
+		}
+		rep.ToolCalls = append(rep.ToolCalls, ToolCall{ID: id, Type: "function", Function: FunctionCall{Name: tc.Name, Arguments: args}})
+	}
+	if rep.FinishReason == "" {
+		rep.FinishReason = "stop"
+		if len(rep.ToolCalls) > 0 {
+			rep.FinishReason = "tool_calls"
+		}
+	}
+	if rep.PromptTokens == 0 {
+		rep.PromptTokens = 10
+	}
+	if rep.CompletionTokens == 0 {
+		rep.CompletionTokens = countTokens(rep.Content) + countTokens(rep.Reasoning)
+		for _, tc := range rep.ToolCalls {
+			rep.CompletionTokens += countTokens(tc.Function.Arguments)
+		}
+	}
+	return rep
+}
+
+// countTokens approximates tokens by whitespace-separated words, as the
+// streaming responses always have.
+func countTokens(s string) int {
+	return len(strings.Fields(s))
+}
+
+// textChunks splits s into pieces of a few words for streaming. Empty text
+// has no chunks.
+func textChunks(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var chunks []string
+	words := strings.SplitAfter(s, " ")
+	for len(words) > 0 {
+		n := 3
+		if n > len(words) {
+			n = len(words)
+		}
+		chunks = append(chunks, strings.Join(words[:n], ""))
+		words = words[n:]
+	}
+	return chunks
+}
+
+// argumentChunks splits tool call arguments into fragments the way upstreams
+// stream them, cutting through keys and values.
+func argumentChunks(s string) []string {
+	const size = 8
+	var chunks []string
+	runes := []rune(s)
+	for len(runes) > size {
+		chunks = append(chunks, string(runes[:size]))
+		runes = runes[size:]
+	}
+	if len(runes) > 0 {
+		chunks = append(chunks, string(runes))
+	}
+	return chunks
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTextChunks(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"hi", []string{"hi"}},
+		{"one two three", []string{"one two three"}},
+		{"one two three four five", []string{"one two three ", "four five"}},
+		{"a  b", []string{"a  b"}},
+	}
+	for _, tt := range tests {
+		if got := textChunks(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("textChunks(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
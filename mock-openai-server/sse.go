@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// sseStream writes the server-sent events of one tracked request and notices
+// when the client goes away. Every API's streaming handler uses it so that
+// disconnect handling and token accounting behave the same.
+type sseStream struct {
+	w         http.ResponseWriter
+	flusher   http.Flusher
+	r         *http.Request
+	requestID string
+	api       string
+	tokens    int  // completion tokens sent so far
+	array     bool // a streamed JSON array, as Gemini sends without alt=sse
+	sent      int
+
+	fault     *FaultRule
+	malformed bool // the broken chunk has been sent
+	failed    bool // an injected fault ended the stream
+}
+
+// newSSEStream sets the streaming headers and picks up the stream faults
+// attached to r. It answers 500 and returns nil when w cannot stream.
+func newSSEStream(w http.ResponseWriter, r *http.Request, requestID, api string) *sseStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Cache-Control")
+
+	// Create a flusher to ensure data is sent immediately
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return nil
+	}
+	return &sseStream{w: w, flusher: flusher, r: r, requestID: requestID, api: api, fault: faultFrom(r)}
+}
+
+// disconnected reports whether the client has gone away. With
+// -ignore-disconnect the stream carries on like an upstream that keeps
+// generating and billing after the client is gone.
+func (s *sseStream) disconnected() bool {
+	select {
+	case <-s.r.Context().Done():
+	default:
+		return false
+	}
+	tracker.Update(s.requestID, func(rec *RequestRecord) {
+		if !rec.ClientDisconnected {
+			now := time.Now()
+			rec.ClientDisconnected = true
+			rec.DisconnectedAt = &now
+			log.Printf("Streaming request %s: client disconnected after %d chunks", s.requestID, rec.ChunksSent)
+		}
+	})
+	return !*ignoreDisconnect
+}
+
+// wait sleeps for d, returning false early if the client disconnects or a
+// fault ended the stream.
+func (s *sseStream) wait(d time.Duration) bool {
+	if s.failed {
+		return false
+	}
+	if d <= 0 {
+		return true
+	}
+	select {
+	case <-s.r.Context().Done():
+		return !s.disconnected()
+	case <-time.After(d):
+		return true
+	}
+}
+
+// send writes data as JSON, under an "event:" line unless event is empty,
+// and charges tokens to the request record. In array mode data becomes the
+// next array element instead. Stream faults strike here, counting chunks.
+func (s *sseStream) send(event string, data interface{}, tokens int) {
+	if s.failed {
+		return
+	}
+	b, _ := json.Marshal(data)
+	if f := s.fault; f != nil {
+		if !s.wait(f.SlowChunks) {
+			return
+		}
+		switch {
+		case f.DropAfterChunks > 0 && s.sent == f.DropAfterChunks:
+			s.drop(event, b)
+		case f.HangAfterChunks > 0 && s.sent == f.HangAfterChunks:
+			s.hang()
+			return
+		case f.FailAfterChunks > 0 && s.sent == f.FailAfterChunks:
+			s.fail(f.FailStatus)
+			return
+		case f.MalformedAfterChunks > 0 && s.sent == f.MalformedAfterChunks && !s.malformed:
+			s.write(event, b[:len(b)/2])
+			s.malformed = true
+		}
+	}
+	s.write(event, b)
+
+	s.tokens += tokens
+	tracker.Update(s.requestID, func(rec *RequestRecord) {
+		rec.ChunksSent++
+		rec.CompletionTokensCharged += tokens
+		if rec.ClientDisconnected {
+			rec.ChunksAfterDisconnect++
+		} else {
+			rec.CompletionTokensReceived += tokens
+		}
+	})
+}
+
+func (s *sseStream) write(event string, b []byte) {
+	switch {
+	case s.array && s.sent == 0:
+		fmt.Fprintf(s.w, "[%s", b)
+	case s.array:
+		fmt.Fprintf(s.w, ",\r\n%s", b)
+	default:
+		if event != "" {
+			fmt.Fprintf(s.w, "event: %s\n", event)
+		}
+		fmt.Fprintf(s.w, "data: %s\n\n", b)
+	}
+	s.flusher.Flush()
+	s.sent++
+}
+
+// fail ends the stream with the error event of the API, as upstreams do when
+// generation fails midway.
+func (s *sseStream) fail(status int) {
+	log.Printf("Streaming request %s: failing with %d after %d chunks", s.requestID, status, s.sent)
+	msg := faultMessage(status)
+	var event string
+	var data interface{}
+	switch s.api {
+	case apiMessages:
+		event, data = "error", anthropicError(status, msg)
+	case apiGemini:
+		data = googleError(status, msg)
+	case apiResponses:
+		event, data = "error", map[string]interface{}{
+			"type": "error", "code": MapError(status, msg).Error.Type, "message": msg, "param": nil, "sequence_number": s.sent,
+		}
+	default:
+		data = MapError(status, msg)
+	}
+	b, _ := json.Marshal(data)
+	s.write(event, b)
+	if s.array {
+		s.raw("]")
+	}
+	s.failed = true
+}
+
+// drop aborts the connection without ending the stream, after half of the
+// chunk when the rule truncates JSON.
+func (s *sseStream) drop(event string, b []byte) {
+	log.Printf("Streaming request %s: dropping the connection after %d chunks", s.requestID, s.sent)
+	if s.fault.TruncateJSON {
+		switch {
+		case s.array && s.sent == 0:
+			fmt.Fprintf(s.w, "[%s", b[:len(b)/2])
+		case s.array:
+			fmt.Fprintf(s.w, ",\r\n%s", b[:len(b)/2])
+		default:
+			if event != "" {
+				fmt.Fprintf(s.w, "event: %s\n", event)
+			}
+			fmt.Fprintf(s.w, "data: %s", b[:len(b)/2])
+		}
+		s.flusher.Flush()
+	}
+	s.failed = true
+	s.finish(false)
+	panic(http.ErrAbortHandler)
+}
+
+// hang stops sending but keeps the connection open until the client gives up.
+func (s *sseStream) hang() {
+	log.Printf("Streaming request %s: hanging after %d chunks", s.requestID, s.sent)
+	<-s.r.Context().Done()
+	s.disconnected()
+	s.failed = true
+}
+
+// raw writes s verbatim, e.g. the "data: [DONE]" terminator.
+func (s *sseStream) raw(text string) {
+	if s.failed {
+		return
+	}
+	fmt.Fprint(s.w, text)
+	s.flusher.Flush()
+}
+
+// finish marks the request finished, and completed unless the stream was cut
+// short.
+func (s *sseStream) finish(completed bool) {
+	tracker.Update(s.requestID, func(rec *RequestRecord) {
+		now := time.Now()
+		rec.FinishedAt = &now
+		if completed && !s.failed {
+			rec.Completed = true
+		}
+	})
+}
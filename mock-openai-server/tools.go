@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ToolSpec is a declared function, independent of the API it came from.
+type ToolSpec struct {
+	Name       string
+	Parameters map[string]interface{} // JSON schema
+}
+
+// toolReply answers requests that declare tools and match no scenario, the
+// way a model following the tool protocol would: it calls a tool until the
+// conversation carries tool results, then answers from them. It returns nil
+// when no tools may be called.
+func toolReply(conv *Conversation) *Reply {
+	if conv.LastRole == "tool" {
+		return &Reply{
+			Content:          "Based on the tool results: " + conv.LastToolResult,
+			FinishReason:     "stop",
+			PromptTokens:     10,
+			CompletionTokens: 5 + countTokens(conv.LastToolResult),
+		}
+	}
+	if len(conv.Tools) == 0 || conv.ToolChoice == "none" {
+		return nil
+	}
+
+	tool := conv.Tools[0]
+	if conv.ToolChoice != "" && conv.ToolChoice != "auto" && conv.ToolChoice != "required" {
+		found := false
+		for _, t := range conv.Tools {
+			if t.Name == conv.ToolChoice {
+				tool, found = t, true
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	value := exampleValue(tool.Parameters, "")
+	if _, ok := value.(map[string]interface{}); !ok {
+		value = map[string]interface{}{} // arguments are always an object, even for "parameters": {}
+	}
+	args, _ := json.Marshal(value)
+	return &Reply{
+		ToolCalls: []ToolCall{{
+			ID:       fmt.Sprintf("call_%s_%d", tool.Name, conv.Turn),
+			Type:     "function",
+			Function: FunctionCall{Name: tool.Name, Arguments: string(args)},
+		}},
+		FinishReason:     "tool_calls",
+		PromptTokens:     10,
+		CompletionTokens: countTokens(string(args)) + 5,
+	}
+}
+
+// argumentsObject returns the arguments of a call for APIs that carry them as
+// a JSON object rather than a string. Anything but an object becomes {}.
+func argumentsObject(args string) json.RawMessage {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal([]byte(args), &obj) != nil || obj == nil {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(args)
+}
+
+// exampleRe picks an example out of descriptions like "The city, e.g. Beijing".
+var exampleRe = regexp.MustCompile(`(?i)\be\.g\.,?\s*([^,;.()]+)`)
+
+// exampleValue generates a value valid against schema, preferring const,
+// default, enum, examples and an "e.g." in the description over made-up
+// values. Every declared object property is filled in. Numeric bounds,
+// minItems, string lengths and allOf are honoured; pattern, multipleOf and
+// uniqueItems are not.
+func exampleValue(schema map[string]interface{}, name string) interface{} {
+	if branches, ok := schema["allOf"].([]interface{}); ok && len(branches) > 0 {
+		schema = mergeAllOf(schema, branches)
+	}
+	if v, ok := schema["const"]; ok {
+		return v
+	}
+	if v, ok := schema["default"]; ok {
+		return v
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	if examples, ok := schema["examples"].([]interface{}); ok && len(examples) > 0 {
+		return examples[0]
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		if alts, ok := schema[key].([]interface{}); ok && len(alts) > 0 {
+			if alt, ok := alts[0].(map[string]interface{}); ok {
+				return exampleValue(alt, name)
+			}
+		}
+	}
+
+	typ, _ := schema["type"].(string)
+	if types, ok := schema["type"].([]interface{}); ok { // e.g. ["string", "null"]
+		for _, t := range types {
+			if s, _ := t.(string); s != "null" {
+				typ = s
+				break
+			}
+		}
+	}
+	if typ == "" {
+		switch {
+		case schema["properties"] != nil:
+			typ = "object"
+		case schema["items"] != nil:
+			typ = "array"
+		default:
+			typ = "string"
+		}
+	}
+
+	switch typ {
+	case "object":
+		props, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(props))
+		for n := range props {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		obj := make(map[string]interface{}, len(props))
+		for _, n := range names {
+			sub, _ := props[n].(map[string]interface{})
+			obj[n] = exampleValue(sub, n)
+		}
+		return obj
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		n := 1
+		if min, ok := schema["minItems"].(float64); ok && int(min) > n {
+			n = int(min)
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			arr[i] = exampleValue(items, name)
+		}
+		return arr
+	case "integer":
+		return int(exampleNumber(schema, 1, true))
+	case "number":
+		return exampleNumber(schema, 1.5, false)
+	case "boolean":
+		return true
+	case "null":
+		return nil
+	}
+
+	switch schema["format"] {
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "https://example.com"
+	}
+	str := "example"
+	desc, _ := schema["description"].(string)
+	if m := exampleRe.FindStringSubmatch(desc); m != nil {
+		str = strings.TrimSpace(m[1])
+	} else if name != "" {
+		str = "example " + name
+	}
+	return fitLength(schema, str)
+}
+
+// mergeAllOf folds the allOf branches into schema: properties are merged,
+// required lists joined and other keywords of later branches win.
+func mergeAllOf(schema map[string]interface{}, branches []interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(schema))
+	props := make(map[string]interface{})
+	var required []interface{}
+	add := func(s map[string]interface{}) {
+		for k, v := range s {
+			switch k {
+			case "allOf":
+			case "properties":
+				p, _ := v.(map[string]interface{})
+				for n, sub := range p {
+					props[n] = sub
+				}
+			case "required":
+				r, _ := v.([]interface{})
+				required = append(required, r...)
+			default:
+				merged[k] = v
+			}
+		}
+	}
+	add(schema)
+	for _, b := range branches {
+		branch, ok := b.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if nested, ok := branch["allOf"].([]interface{}); ok {
+			branch = mergeAllOf(branch, nested)
+		}
+		add(branch)
+	}
+	if len(props) > 0 {
+		merged["properties"] = props
+	}
+	if len(required) > 0 {
+		merged["required"] = required
+	}
+	return merged
+}
+
+// exampleNumber picks the minimum of a numeric schema, or fallback when there
+// is none, and keeps it below the maximum. Exclusive bounds are read in both
+// the draft 4 (boolean) and the later (number) form.
+func exampleNumber(schema map[string]interface{}, fallback float64, integer bool) float64 {
+	lo, hi := math.Inf(-1), math.Inf(1)
+	loExcl, hiExcl := false, false
+	if v, ok := schema["minimum"].(float64); ok {
+		lo, loExcl = v, schema["exclusiveMinimum"] == true
+	}
+	if v, ok := schema["exclusiveMinimum"].(float64); ok && v >= lo {
+		lo, loExcl = v, true
+	}
+	if v, ok := schema["maximum"].(float64); ok {
+		hi, hiExcl = v, schema["exclusiveMaximum"] == true
+	}
+	if v, ok := schema["exclusiveMaximum"].(float64); ok && v <= hi {
+		hi, hiExcl = v, true
+	}
+	if integer { // make both bounds inclusive integers
+		if c := math.Ceil(lo); c == lo && loExcl {
+			lo = c + 1
+		} else {
+			lo = c
+		}
+		if f := math.Floor(hi); f == hi && hiExcl {
+			hi = f - 1
+		} else {
+			hi = f
+		}
+		loExcl, hiExcl = false, false
+	}
+
+	v := fallback
+	switch {
+	case math.IsInf(lo, -1):
+	case loExcl:
+		v = lo + 1
+	default:
+		v = lo
+	}
+	if v > hi || (hiExcl && v == hi) {
+		switch {
+		case integer || !hiExcl:
+			v = hi
+		case math.IsInf(lo, -1):
+			v = hi - 1
+		default:
+			v = (lo + hi) / 2
+		}
+	}
+	return v
+}
+
+// fitLength pads or truncates s to the minLength and maxLength of schema.
+func fitLength(schema map[string]interface{}, s string) string {
+	runes := []rune(s)
+	if max, ok := schema["maxLength"].(float64); ok && len(runes) > int(max) {
+		runes = runes[:int(max)]
+	}
+	if min, ok := schema["minLength"].(float64); ok && len(runes) < int(min) {
+		runes = append(runes, []rune(strings.Repeat("x", int(min)-len(runes)))...)
+	}
+	return string(runes)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExampleValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{"const wins", `{"type":"string","const":"fixed","default":"d"}`, `"fixed"`},
+		{"default", `{"type":"integer","default":42}`, `42`},
+		{"enum", `{"type":"string","enum":["celsius","fahrenheit"]}`, `"celsius"`},
+		{"examples", `{"type":"string","examples":["Oslo"]}`, `"Oslo"`},
+		{"e.g. in description", `{"type":"string","description":"The city, e.g. San Francisco, CA"}`, `"San Francisco"`},
+		{"property name", `{"type":"object","properties":{"city":{"type":"string"}}}`, `{"city":"example city"}`},
+		{"formats", `{"type":"object","properties":{"at":{"type":"string","format":"date-time"},"mail":{"type":"string","format":"email"}}}`,
+			`{"at":"2024-01-01T00:00:00Z","mail":"user@example.com"}`},
+		{"nullable type", `{"type":["null","boolean"]}`, `true`},
+		{"untyped with properties", `{"properties":{"n":{"type":"number"}}}`, `{"n":1.5}`},
+		{"anyOf", `{"anyOf":[{"type":"integer"},{"type":"string"}]}`, `1`},
+		{"array minItems", `{"type":"array","items":{"type":"integer","minimum":3},"minItems":2}`, `[3,3]`},
+		{"integer exclusive minimum", `{"type":"integer","exclusiveMinimum":5}`, `6`},
+		{"integer draft 4 exclusive minimum", `{"type":"integer","minimum":5,"exclusiveMinimum":true}`, `6`},
+		{"integer below maximum", `{"type":"integer","maximum":0}`, `0`},
+		{"number exclusive range", `{"type":"number","exclusiveMinimum":0,"exclusiveMaximum":1}`, `0.5`},
+		{"number exclusive maximum only", `{"type":"number","exclusiveMaximum":-2}`, `-3`},
+		{"string lengths", `{"type":"object","properties":{"a":{"type":"string","minLength":12},"b":{"type":"string","maxLength":3}}}`,
+			`{"a":"example axxx","b":"exa"}`},
+		{"allOf", `{"allOf":[{"type":"object","properties":{"a":{"type":"boolean"}}},{"properties":{"b":{"type":"integer","minimum":2}}}]}`,
+			`{"a":true,"b":2}`},
+		{"empty schema", `{}`, `"example"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(exampleValue(schema, ""))
+			var g, w interface{}
+			json.Unmarshal(got, &g)
+			json.Unmarshal([]byte(tt.want), &w)
+			if !reflect.DeepEqual(g, w) {
+				t.Errorf("exampleValue(%s) = %s, want %s", tt.schema, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgumentsObject(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"a":1}`, `{"a":1}`},
+		{``, `{}`},
+		{`null`, `{}`},
+		{`[1]`, `{}`},
+		{`"s"`, `{}`},
+	}
+	for _, tt := range tests {
+		if got := string(argumentsObject(tt.in)); got != tt.want {
+			t.Errorf("argumentsObject(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxRecords bounds how many request records are kept for /debug/requests.
+const maxRecords = 1000
+
+var requestCounter uint64
+
+// RequestRecord describes what the server did for one completion request, so
+// clients can check whether generation stopped when they disconnected.
+type RequestRecord struct {
+	ID                       string     `json:"id"`
+	Model                    string     `json:"model"`
+	Stream                   bool       `json:"stream"`
+	StartedAt                time.Time  `json:"started_at"`
+	FinishedAt               *time.Time `json:"finished_at,omitempty"`
+	ChunksSent               int        `json:"chunks_sent"`
+	Completed                bool       `json:"completed"`
+	ClientDisconnected       bool       `json:"client_disconnected"`
+	DisconnectedAt           *time.Time `json:"disconnected_at,omitempty"`
+	ChunksAfterDisconnect    int        `json:"chunks_after_disconnect"`
+	CompletionTokensCharged  int        `json:"completion_tokens_charged"`
+	CompletionTokensReceived int        `json:"completion_tokens_received"`
+}
+
+type requestTracker struct {
+	mu      sync.Mutex
+	records map[string]*RequestRecord
+	order   []string
+}
+
+var tracker = &requestTracker{records: make(map[string]*RequestRecord)}
+
+func newRequestID() string {
+	return fmt.Sprintf("req-%d-%d", startTime.Unix(), atomic.AddUint64(&requestCounter, 1))
+}
+
+func (t *requestTracker) Start(id, model string, stream bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.records[id] = &RequestRecord{ID: id, Model: model, Stream: stream, StartedAt: time.Now()}
+	t.order = append(t.order, id)
+	if len(t.order) > maxRecords {
+		delete(t.records, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+// Update applies fn to the record under lock; unknown ids are ignored.
+func (t *requestTracker) Update(id string, fn func(rec *RequestRecord)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if rec, ok := t.records[id]; ok {
+		fn(rec)
+	}
+}
+
+func (t *requestTracker) Get(id string) (RequestRecord, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rec, ok := t.records[id]
+	if !ok {
+		return RequestRecord{}, false
+	}
+	return *rec, true
+}
+
+func handleDebugRequest(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	rec, ok := tracker.Get(id)
+	if !ok {
+		http.Error(w, "request "+id+" not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func models(ctx context.Context, client *openai.Client, model string) error {
+	fmt.Println("----- List Models Test -----")
+
+	resp, err := client.ListModels(ctx)
+	if err != nil {
+		fmt.Printf("List models error: %v\n", err)
+		return err
+	}
+
+	fmt.Println("Models response:")
+	fmt.Println(MustMarshal(resp.Models))
+	fmt.Println("--------------------------------")
+
+	problems := validateModels(resp.Models)
+	for _, p := range problems {
+		fmt.Println("  ✗", p)
+	}
+	if len(problems) == 0 {
+		fmt.Printf("  ✓ response shape ok, %d models listed\n", len(resp.Models))
+	} else {
+		err = fmt.Errorf("invalid models response: %s", strings.Join(problems, "; "))
+	}
+
+	if model == "" {
+		fmt.Println("  - MODEL not set, skip listed check")
+		return err
+	}
+	for _, m := range resp.Models {
+		if m.ID == model {
+			fmt.Printf("  ✓ configured model %s is listed\n", model)
+			return err
+		}
+	}
+	fmt.Printf("  ✗ configured model %s is not listed\n", model)
+	return errors.Join(err, fmt.Errorf("configured model %s is not listed", model))
+}
+
+// validateModels checks each entry against the OpenAI model object shape.
+func validateModels(list []openai.Model) []string {
+	if len(list) == 0 {
+		return []string{"model list is empty"}
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for i, m := range list {
+		if m.ID == "" {
+			problems = append(problems, fmt.Sprintf("data[%d]: missing id", i))
+			continue
+		}
+		if seen[m.ID] {
+			problems = append(problems, fmt.Sprintf("data[%d]: duplicate id %s", i, m.ID))
+		}
+		seen[m.ID] = true
+		if m.Object != "model" {
+			problems = append(problems, fmt.Sprintf("data[%d] %s: object is %q, want \"model\"", i, m.ID, m.Object))
+		}
+		if m.OwnedBy == "" {
+			problems = append(problems, fmt.Sprintf("data[%d] %s: missing owned_by", i, m.ID))
+		}
+		if m.CreatedAt <= 0 {
+			problems = append(problems, fmt.Sprintf("data[%d] %s: missing created", i, m.ID))
+		}
+	}
+	return problems
+}
+
+// discoverModels returns the ids of every model listed by the endpoint.
+func discoverModels(ctx context.Context, client *openai.Client) ([]string, error) {
+	resp, err := client.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list models: %w", err)
+	}
+	ids := make([]string, 0, len(resp.Models))
+	for _, m := range resp.Models {
+		if m.ID != "" {
+			ids = append(ids, m.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no models listed")
+	}
+	return ids, nil
+}
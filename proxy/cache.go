@@ -0,0 +1,120 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheTTL  = 10 * time.Minute
+	defaultCacheSize = 256 // MiB
+
+	// cacheHeader tells the client whether a response came from the cache.
+	// Sent by the client, "refresh" skips the lookup but stores the new
+	// response and "bypass" skips the cache entirely.
+	cacheHeader = "X-Proxy-Cache"
+)
+
+// responseCache keeps successful responses in memory, keyed like recordings
+// plus the client's credential, and evicts the least recently used ones once maxBytes is exceeded.
+type responseCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	maxBytes int64
+	size     int64
+	lru      *list.List // front is most recently used
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	rec     *recording
+	size    int64
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration, maxBytes int64) *responseCache {
+	return &responseCache{ttl: ttl, maxBytes: maxBytes, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// cachePolicy reads the client's cache directives: lookup is false for
+// "X-Proxy-Cache: refresh|bypass" and "Cache-Control: no-cache", store is
+// false for "bypass" and "no-store".
+func cachePolicy(h http.Header) (lookup, store bool) {
+	lookup, store = true, true
+	switch strings.ToLower(h.Get(cacheHeader)) {
+	case "refresh":
+		lookup = false
+	case "bypass":
+		lookup, store = false, false
+	}
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			switch strings.ToLower(strings.TrimSpace(d)) {
+			case "no-cache":
+				lookup = false
+			case "no-store":
+				lookup, store = false, false
+			}
+		}
+	}
+	return lookup, store
+}
+
+// cacheKey scopes a request key to the client's credential, so a response is
+// only served back to the API key that paid for it.
+func cacheKey(key, credential string) string {
+	h := sha256.Sum256([]byte(key + "\n" + credential))
+	return hex.EncodeToString(h[:16])
+}
+
+// Get returns the unexpired response stored under key, or nil.
+func (c *responseCache) Get(key string) *recording {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el := c.entries[key]
+	if el == nil {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return e.rec
+}
+
+// Put stores rec under key. Responses larger than the whole cache are not
+// stored.
+func (c *responseCache) Put(key string, rec *recording) {
+	size := int64(len(rec.Body))
+	for _, ev := range rec.Events {
+		size += int64(len(ev.Raw))
+	}
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el := c.entries[key]; el != nil {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, rec: rec, size: size, expires: time.Now().Add(c.ttl)})
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *responseCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	ignore := ignoreSet(defaultVolatileFields, defaultRedactFields)
+	key := func(target, body string, headers ...string) string {
+		r := httptest.NewRequest("POST", target, strings.NewReader(body))
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		return cacheKey(requestKey(r, []byte(body), ignore), clientCredential(r))
+	}
+	base := key("/v1/chat/completions", `{"model":"m","messages":[]}`, "Authorization", "Bearer sk-a")
+
+	tests := []struct {
+		name string
+		got  string
+		same bool
+	}{
+		{"same request", key("/v1/chat/completions", `{"model":"m","messages":[]}`, "Authorization", "Bearer sk-a"), true},
+		{"key order and volatile fields", key("/v1/chat/completions", `{"messages":[],"user":"u","model":"m"}`, "Authorization", "Bearer sk-a"), true},
+		{"same key without Bearer", key("/v1/chat/completions", `{"model":"m","messages":[]}`, "Authorization", "sk-a"), true},
+		{"other API key", key("/v1/chat/completions", `{"model":"m","messages":[]}`, "Authorization", "Bearer sk-b"), false},
+		{"no API key", key("/v1/chat/completions", `{"model":"m","messages":[]}`), false},
+		{"x-api-key", key("/v1/chat/completions", `{"model":"m","messages":[]}`, "X-Api-Key", "sk-b"), false},
+		{"other body", key("/v1/chat/completions", `{"model":"n","messages":[]}`, "Authorization", "Bearer sk-a"), false},
+		{"other path", key("/v1/completions", `{"model":"m","messages":[]}`, "Authorization", "Bearer sk-a"), false},
+	}
+	for _, tt := range tests {
+		if (tt.got == base) != tt.same {
+			t.Errorf("%s: same key = %v, want %v", tt.name, tt.got == base, tt.same)
+		}
+	}
+
+	if a, b := key("/v1/x?key=k1", `{}`), key("/v1/x?key=k2", `{}`); a == b {
+		t.Error("?key= credentials share cache entries")
+	}
+	if a, b := cacheKey("k", ""), cacheKey("k", ""); a != b || len(a) != 32 {
+		t.Errorf("anonymous keys %q and %q, want equal 32 hex digits", a, b)
+	}
+}
+
+func TestCachePolicy(t *testing.T) {
+	tests := []struct {
+		header, value string
+		lookup, store bool
+	}{
+		{"", "", true, true},
+		{cacheHeader, "refresh", false, true},
+		{cacheHeader, "BYPASS", false, false},
+		{"Cache-Control", "no-cache", false, true},
+		{"Cache-Control", "max-age=0, no-store", false, false},
+		{"Cache-Control", "max-age=60", true, true},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.header != "" {
+			h.Set(tt.header, tt.value)
+		}
+		lookup, store := cachePolicy(h)
+		if lookup != tt.lookup || store != tt.store {
+			t.Errorf("%s: %s: lookup, store = %v, %v, want %v, %v", tt.header, tt.value, lookup, store, tt.lookup, tt.store)
+		}
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	c := newResponseCache(time.Hour, 10)
+	c.Put("a", &recording{Body: "aaaa"})
+	c.Put("b", &recording{Body: "bbbb"})
+	c.Get("a") // a is now the most recently used
+	c.Put("c", &recording{Body: "cccc"})
+	if c.Get("b") != nil {
+		t.Error("least recently used entry b not evicted")
+	}
+	if c.Get("a") == nil || c.Get("c") == nil {
+		t.Error("recently used entries evicted")
+	}
+	c.Put("big", &recording{Body: strings.Repeat("x", 11)})
+	if c.Get("big") != nil || c.Get("a") == nil {
+		t.Error("entry larger than the cache stored or evicted others")
+	}
+
+	expired := newResponseCache(-time.Second, 10)
+	expired.Put("a", &recording{Body: "a"})
+	if expired.Get("a") != nil || expired.size != 0 {
+		t.Error("expired entry served or still counted")
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	protoChat      = "openai-chat"
+	protoMessages  = "anthropic-messages"
+	protoGemini    = "gemini"
+	protoResponses = "openai-responses"
+)
+
+// llmSummary is the compact, protocol-independent view of one LLM exchange.
+type llmSummary struct {
+	Protocol     string     `json:"protocol"`
+	Model        string     `json:"model,omitempty"`
+	Stream       bool       `json:"stream"`
+	Messages     int        `json:"messages"`
+	Tools        []string   `json:"tools,omitempty"`
+	ToolCalls    []toolCall `json:"tool_calls,omitempty"`
+	FinishReason string     `json:"finish_reason,omitempty"`
+	Usage        llmUsage   `json:"usage"`
+	Thinking     string     `json:"thinking,omitempty"`
+	Text         string     `json:"text,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+type toolCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type llmUsage struct {
+	Input  int `json:"input"`
+	Output int `json:"output"`
+	Total  int `json:"total"`
+}
+
+// detectProtocol recognises the LLM API spoken by a request from its path,
+// falling back to the shape of the JSON body.
+func detectProtocol(path string, body map[string]interface{}) string {
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"):
+		return protoChat
+	case strings.HasSuffix(path, "/messages"):
+		return protoMessages
+	case strings.Contains(path, ":generateContent"), strings.Contains(path, ":streamGenerateContent"):
+		return protoGemini
+	case strings.HasSuffix(path, "/responses"):
+		return protoResponses
+	}
+	if body == nil {
+		return ""
+	}
+	switch {
+	case body["contents"] != nil:
+		return protoGemini
+	case body["input"] != nil:
+		return protoResponses
+	case body["messages"] != nil && body["max_tokens"] != nil && body["system"] != nil:
+		return protoMessages
+	case body["messages"] != nil:
+		return protoChat
+	}
+	return ""
+}
+
+// summarize decodes the captured request and response of ex. It returns nil
+// for traffic that is not a recognised LLM API call.
+func summarize(ex *exchange) *llmSummary {
+	var req map[string]interface{}
+	json.Unmarshal(ex.reqBody, &req)
+	proto := detectProtocol(ex.path, req)
+	if proto == "" {
+		return nil
+	}
+
+	s := &llmSummary{Protocol: proto}
+	s.decodeRequest(ex.path, req)
+
+	d := &responseDecoder{s: s, toolIndex: make(map[int]int)}
+	if ex.stream {
+		for _, ev := range ex.events {
+			var event map[string]interface{}
+			if json.Unmarshal([]byte(ev.Data), &event) == nil {
+				d.decode(event)
+			}
+		}
+	} else {
+		d.decodeBody(decodedBody(ex.respHeader, ex.body.Bytes()))
+	}
+	return s
+}
+
+func (s *llmSummary) decodeRequest(path string, req map[string]interface{}) {
+	s.Model, _ = req["model"].(string)
+	s.Stream, _ = req["stream"].(bool)
+
+	switch s.Protocol {
+	case protoChat, protoMessages:
+		s.Messages = lenOf(req["messages"])
+	case protoResponses:
+		if _, ok := req["input"].(string); ok {
+			s.Messages = 1
+		} else {
+			s.Messages = lenOf(req["input"])
+		}
+	case protoGemini:
+		s.Messages = lenOf(req["contents"])
+		s.Model = geminiModel(path)
+		s.Stream = strings.Contains(path, ":streamGenerateContent")
+	}
+
+	for _, t := range asSlice(req["tools"]) {
+		tool := asMap(t)
+		switch {
+		case tool["function"] != nil: // chat completions
+			s.Tools = append(s.Tools, str(asMap(tool["function"])["name"]))
+		case tool["functionDeclarations"] != nil: // gemini
+			for _, fd := range asSlice(tool["functionDeclarations"]) {
+				s.Tools = append(s.Tools, str(asMap(fd)["name"]))
+			}
+		case tool["name"] != nil: // anthropic and responses
+			s.Tools = append(s.Tools, str(tool["name"]))
+		default:
+			s.Tools = append(s.Tools, str(tool["type"]))
+		}
+	}
+}
+
+// geminiModel extracts the model from ".../models/{model}:generateContent".
+func geminiModel(path string) string {
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		path = path[:i]
+	}
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// responseDecoder accumulates streamed or complete responses into a summary.
+type responseDecoder struct {
+	s         *llmSummary
+	text      strings.Builder
+	thinking  strings.Builder
+	toolIndex map[int]int // stream tool call index -> position in s.ToolCalls
+}
+
+func (d *responseDecoder) decodeBody(body []byte) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return
+	}
+	// Gemini streams without alt=sse arrive as one JSON array of responses
+	if arr, ok := v.([]interface{}); ok {
+		for _, item := range arr {
+			d.decode(asMap(item))
+		}
+		return
+	}
+	d.decode(asMap(v))
+}
+
+func (d *responseDecoder) decode(event map[string]interface{}) {
+	if e := asMap(event["error"]); e != nil {
+		d.s.Error = str(e["message"])
+	}
+	switch d.s.Protocol {
+	case protoChat:
+		d.decodeChat(event)
+	case protoMessages:
+		d.decodeMessages(event)
+	case protoGemini:
+		d.decodeGemini(event)
+	case protoResponses:
+		d.decodeResponses(event)
+	}
+	d.s.Text = d.text.String()
+	d.s.Thinking = d.thinking.String()
+}
+
+func (d *responseDecoder) decodeChat(event map[string]interface{}) {
+	if u := asMap(event["usage"]); u != nil {
+		d.s.Usage = llmUsage{Input: num(u["prompt_tokens"]), Output: num(u["completion_tokens"]), Total: num(u["total_tokens"])}
+	}
+	choices := asSlice(event["choices"])
+	if len(choices) == 0 {
+		return
+	}
+	choice := asMap(choices[0])
+	if fr := str(choice["finish_reason"]); fr != "" {
+		d.s.FinishReason = fr
+	}
+
+	if msg := asMap(choice["message"]); msg != nil {
+		d.text.WriteString(str(msg["content"]))
+		d.thinking.WriteString(str(msg["reasoning_content"]))
+		for _, tc := range asSlice(msg["tool_calls"]) {
+			fn := asMap(asMap(tc)["function"])
+			d.s.ToolCalls = append(d.s.ToolCalls, toolCall{Name: str(fn["name"]), Arguments: str(fn["arguments"])})
+		}
+		return
+	}
+
+	delta := asMap(choice["delta"])
+	d.text.WriteString(str(delta["content"]))
+	d.thinking.WriteString(str(delta["reasoning_content"]))
+	for _, tc := range asSlice(delta["tool_calls"]) {
+		call := asMap(tc)
+		fn := asMap(call["function"])
+		pos, ok := d.toolIndex[num(call["index"])]
+		if !ok {
+			pos = len(d.s.ToolCalls)
+			d.toolIndex[num(call["index"])] = pos
+			d.s.ToolCalls = append(d.s.ToolCalls, toolCall{})
+		}
+		d.s.ToolCalls[pos].Name += str(fn["name"])
+		d.s.ToolCalls[pos].Arguments += str(fn["arguments"])
+	}
+}
+
+func (d *responseDecoder) decodeMessages(event map[string]interface{}) {
+	switch str(event["type"]) {
+	case "message":
+		for _, b := range asSlice(event["content"]) {
+			block := asMap(b)
+			switch str(block["type"]) {
+			case "text":
+				d.text.WriteString(str(block["text"]))
+			case "thinking":
+				d.thinking.WriteString(str(block["thinking"]))
+			case "tool_use":
+				args, _ := json.Marshal(block["input"])
+				d.s.ToolCalls = append(d.s.ToolCalls, toolCall{Name: str(block["name"]), Arguments: string(args)})
+			}
+		}
+		d.s.FinishReason = str(event["stop_reason"])
+		d.messagesUsage(asMap(event["usage"]))
+	case "message_start":
+		d.messagesUsage(asMap(asMap(event["message"])["usage"]))
+	case "content_block_start":
+		block := asMap(event["content_block"])
+		if str(block["type"]) == "tool_use" {
+			d.toolIndex[num(event["index"])] = len(d.s.ToolCalls)
+			d.s.ToolCalls = append(d.s.ToolCalls, toolCall{Name: str(block["name"])})
+		}
+	case "content_block_delta":
+		delta := asMap(event["delta"])
+		switch str(delta["type"]) {
+		case "text_delta":
+			d.text.WriteString(str(delta["text"]))
+		case "thinking_delta":
+			d.thinking.WriteString(str(delta["thinking"]))
+		case "input_json_delta":
+			if pos, ok := d.toolIndex[num(event["index"])]; ok {
+				d.s.ToolCalls[pos].Arguments += str(delta["partial_json"])
+			}
+		}
+	case "message_delta":
+		if sr := str(asMap(event["delta"])["stop_reason"]); sr != "" {
+			d.s.FinishReason = sr
+		}
+		d.messagesUsage(asMap(event["usage"]))
+	}
+}
+
+// messagesUsage merges Anthropic usage, which arrives split across events.
+func (d *responseDecoder) messagesUsage(u map[string]interface{}) {
+	if u == nil {
+		return
+	}
+	if v, ok := u["input_tokens"]; ok && num(v) > 0 {
+		d.s.Usage.Input = num(v)
+	}
+	if v, ok := u["output_tokens"]; ok && num(v) > 0 {
+		d.s.Usage.Output = num(v)
+	}
+	d.s.Usage.Total = d.s.Usage.Input + d.s.Usage.Output
+}
+
+func (d *responseDecoder) decodeGemini(event map[string]interface{}) {
+	if u := asMap(event["usageMetadata"]); u != nil {
+		// thoughts are output too, as reasoning is in OpenAI's completion_tokens
+		d.s.Usage = llmUsage{Input: num(u["promptTokenCount"]), Output: num(u["candidatesTokenCount"]) + num(u["thoughtsTokenCount"]), Total: num(u["totalTokenCount"])}
+	}
+	candidates := asSlice(event["candidates"])
+	if len(candidates) == 0 {
+		return
+	}
+	candidate := asMap(candidates[0])
+	if fr := str(candidate["finishReason"]); fr != "" {
+		d.s.FinishReason = fr
+	}
+	for _, p := range asSlice(asMap(candidate["content"])["parts"]) {
+		part := asMap(p)
+		switch {
+		case part["functionCall"] != nil:
+			fc := asMap(part["functionCall"])
+			args, _ := json.Marshal(fc["args"])
+			d.s.ToolCalls = append(d.s.ToolCalls, toolCall{Name: str(fc["name"]), Arguments: string(args)})
+		case part["thought"] == true:
+			d.thinking.WriteString(str(part["text"]))
+		default:
+			d.text.WriteString(str(part["text"]))
+		}
+	}
+}
+
+func (d *responseDecoder) decodeResponses(event map[string]interface{}) {
+	if str(event["object"]) == "response" {
+		d.responsesOutput(event)
+		return
+	}
+	switch str(event["type"]) {
+	case "response.output_text.delta":
+		d.text.WriteString(str(event["delta"]))
+	case "response.reasoning_summary_text.delta":
+		d.thinking.WriteString(str(event["delta"]))
+	case "response.output_item.done":
+		item := asMap(event["item"])
+		if str(item["type"]) == "function_call" {
+			d.s.ToolCalls = append(d.s.ToolCalls, toolCall{Name: str(item["name"]), Arguments: str(item["arguments"])})
+		}
+	case "response.completed", "response.incomplete", "response.failed":
+		resp := asMap(event["response"])
+		d.s.FinishReason = str(resp["status"])
+		d.responsesUsage(asMap(resp["usage"]))
+		if e := asMap(resp["error"]); e != nil {
+			d.s.Error = str(e["message"])
+		}
+	}
+}
+
+func (d *responseDecoder) responsesOutput(resp map[string]interface{}) {
+	for _, o := range asSlice(resp["output"]) {
+		item := asMap(o)
+		switch str(item["type"]) {
+		case "message":
+			for _, c := range asSlice(item["content"]) {
+				d.text.WriteString(str(asMap(c)["text"]))
+			}
+		case "reasoning":
+			for _, c := range asSlice(item["summary"]) {
+				d.thinking.WriteString(str(asMap(c)["text"]))
+			}
+		case "function_call":
+			d.s.ToolCalls = append(d.s.ToolCalls, toolCall{Name: str(item["name"]), Arguments: str(item["arguments"])})
+		}
+	}
+	d.s.FinishReason = str(resp["status"])
+	d.responsesUsage(asMap(resp["usage"]))
+}
+
+func (d *responseDecoder) responsesUsage(u map[string]interface{}) {
+	if u != nil {
+		d.s.Usage = llmUsage{Input: num(u["input_tokens"]), Output: num(u["output_tokens"]), Total: num(u["total_tokens"])}
+	}
+}
+
+// String renders the summary as a few compact log lines.
+func (s *llmSummary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s model=%s stream=%t messages=%d", s.Protocol, s.Model, s.Stream, s.Messages)
+	if len(s.Tools) > 0 {
+		tools := append([]string(nil), s.Tools...)
+		sort.Strings(tools)
+		fmt.Fprintf(&b, " tools=[%s]", strings.Join(tools, ","))
+	}
+	fmt.Fprintf(&b, "\n    finish_reason=%s usage: in=%d out=%d total=%d", s.FinishReason, s.Usage.Input, s.Usage.Output, s.Usage.Total)
+	for _, tc := range s.ToolCalls {
+		fmt.Fprintf(&b, "\n    tool_call: %s(%s)", tc.Name, tc.Arguments)
+	}
+	if s.Error != "" {
+		fmt.Fprintf(&b, "\n    error: %s", s.Error)
+	}
+	if s.Thinking != "" {
+		fmt.Fprintf(&b, "\n    thinking: %s", s.Thinking)
+	}
+	if s.Text != "" {
+		fmt.Fprintf(&b, "\n    text: %s", s.Text)
+	}
+	return b.String()
+}
+
+// decodedBody undoes gzip content encoding so the body can be parsed.
+func decodedBody(h http.Header, body []byte) []byte {
+	if h.Get("Content-Encoding") != "gzip" {
+		return body
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return body
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		return body
+	}
+	return plain
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func asSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
+
+func lenOf(v interface{}) int {
+	return len(asSlice(v))
+}
+
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func num(v interface{}) int {
+	f, _ := v.(float64)
+	return int(f)
+}
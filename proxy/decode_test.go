@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDecodedBody(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	zw.Write([]byte(`{"ok":true}`))
+	zw.Close()
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     string
+	}{
+		{"plain", "", []byte(`{"ok":true}`), `{"ok":true}`},
+		{"gzip", "gzip", zipped.Bytes(), `{"ok":true}`},
+		{"other encoding", "br", []byte("xyz"), "xyz"},
+		{"broken gzip", "gzip", []byte("not gzip"), "not gzip"},
+		{"truncated gzip", "gzip", zipped.Bytes()[:zipped.Len()-4], string(zipped.Bytes()[:zipped.Len()-4])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.encoding != "" {
+				h.Set("Content-Encoding", tt.encoding)
+			}
+			if got := string(decodedBody(h, tt.body)); got != tt.want {
+				t.Errorf("decodedBody = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectProtocol(t *testing.T) {
+	tests := []struct {
+		path string
+		body map[string]interface{}
+		want string
+	}{
+		{"/v1/chat/completions", nil, protoChat},
+		{"/v1/messages", nil, protoMessages},
+		{"/v1beta/models/gemini-2.5-pro:streamGenerateContent", nil, protoGemini},
+		{"/v1/responses", nil, protoResponses},
+		{"/custom", map[string]interface{}{"contents": []interface{}{}}, protoGemini},
+		{"/custom", map[string]interface{}{"input": "hi"}, protoResponses},
+		{"/custom", map[string]interface{}{"messages": []interface{}{}, "max_tokens": 1.0, "system": "s"}, protoMessages},
+		{"/custom", map[string]interface{}{"messages": []interface{}{}}, protoChat},
+		{"/v1/models", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := detectProtocol(tt.path, tt.body); got != tt.want {
+			t.Errorf("detectProtocol(%q, %v) = %q, want %q", tt.path, tt.body, got, tt.want)
+		}
+	}
+}
+
+// testExchange builds a finished exchange from a request body and either a
+// response body or, for streams, the data of its SSE events.
+func testExchange(path, req, body string, events ...string) *exchange {
+	ex := &exchange{path: path, reqBody: []byte(req), respHeader: http.Header{}}
+	ex.body.WriteString(body)
+	for _, data := range events {
+		ex.events = append(ex.events, sseEvent{Data: data})
+	}
+	ex.stream = len(events) > 0
+	return ex
+}
+
+func TestSummarizeUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		ex   *exchange
+		want llmUsage
+	}{
+		{
+			"chat",
+			testExchange("/v1/chat/completions", `{"model":"m"}`,
+				`{"choices":[{"message":{"content":"hi"}}],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`),
+			llmUsage{Input: 5, Output: 7, Total: 12},
+		},
+		{
+			"chat stream with include_usage",
+			testExchange("/v1/chat/completions", `{"model":"m","stream":true}`, "",
+				`{"choices":[{"delta":{"content":"hi"}}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`),
+			llmUsage{Input: 5, Output: 1, Total: 6},
+		},
+		{
+			"chat stream without usage",
+			testExchange("/v1/chat/completions", `{"model":"m","stream":true}`, "",
+				`{"choices":[{"delta":{"content":"hi"},"finish_reason":"stop"}]}`),
+			llmUsage{},
+		},
+		{
+			"messages",
+			testExchange("/v1/messages", `{"model":"m"}`,
+				`{"type":"message","content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn","usage":{"input_tokens":9,"output_tokens":3}}`),
+			llmUsage{Input: 9, Output: 3, Total: 12},
+		},
+		{
+			"messages stream split across events",
+			testExchange("/v1/messages", `{"model":"m","stream":true}`, "",
+				`{"type":"message_start","message":{"usage":{"input_tokens":9,"output_tokens":1}}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`,
+				`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":4}}`),
+			llmUsage{Input: 9, Output: 4, Total: 13},
+		},
+		{
+			"gemini counts thoughts as output",
+			testExchange("/v1beta/models/g:generateContent", `{"contents":[]}`,
+				`{"candidates":[{"content":{"parts":[{"text":"hi"}]}}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"thoughtsTokenCount":10,"totalTokenCount":16}}`),
+			llmUsage{Input: 4, Output: 12, Total: 16},
+		},
+		{
+			"gemini stream as JSON array",
+			testExchange("/v1beta/models/g:streamGenerateContent", `{"contents":[]}`,
+				`[{"candidates":[{"content":{"parts":[{"text":"h"}]}}]},{"candidates":[{"content":{"parts":[{"text":"i"}]}}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"totalTokenCount":6}}]`),
+			llmUsage{Input: 4, Output: 2, Total: 6},
+		},
+		{
+			"responses",
+			testExchange("/v1/responses", `{"model":"m","input":"hi"}`,
+				`{"object":"response","status":"completed","output":[],"usage":{"input_tokens":3,"output_tokens":5,"total_tokens":8}}`),
+			llmUsage{Input: 3, Output: 5, Total: 8},
+		},
+		{
+			"responses stream",
+			testExchange("/v1/responses", `{"model":"m","input":"hi","stream":true}`, "",
+				`{"type":"response.output_text.delta","delta":"hi"}`,
+				`{"type":"response.completed","response":{"status":"completed","usage":{"input_tokens":3,"output_tokens":1,"total_tokens":4}}}`),
+			llmUsage{Input: 3, Output: 1, Total: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := summarize(tt.ex)
+			if s == nil {
+				t.Fatal("summarize returned nil")
+			}
+			if s.Usage != tt.want {
+				t.Errorf("usage = %+v, want %+v", s.Usage, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeToolCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		ex   *exchange
+		want []toolCall
+	}{
+		{
+			"chat stream fragments",
+			testExchange("/v1/chat/completions", `{"stream":true,"messages":[]}`, "",
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"name":"get_weather","arguments":""}}]}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`),
+			[]toolCall{{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+		},
+		{
+			"messages tool_use",
+			testExchange("/v1/messages", `{}`,
+				`{"type":"message","content":[{"type":"tool_use","name":"f","input":{"a":1}}]}`),
+			[]toolCall{{Name: "f", Arguments: `{"a":1}`}},
+		},
+		{
+			"gemini functionCall",
+			testExchange("/v1beta/models/g:generateContent", `{}`,
+				`{"candidates":[{"content":{"parts":[{"functionCall":{"name":"f","args":{"a":1}}}]}}]}`),
+			[]toolCall{{Name: "f", Arguments: `{"a":1}`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarize(tt.ex).ToolCalls; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tool calls = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const defaultDumpFile = "proxy-dump.jsonl"
+
+// dumpRecord is one exchange as written by -dump-format jsonl and read back by
+// the query subcommand. Headers and bodies are redacted; JSON bodies and SSE
+// payloads are embedded as JSON, anything else as a string.
+type dumpRecord struct {
+	ID             uint64      `json:"id"`
+	Time           time.Time   `json:"time"`
+	Method         string      `json:"method"`
+	Path           string      `json:"path"`
+	Query          string      `json:"query,omitempty"`
+	Upstream       string      `json:"upstream"`
+	URL            string      `json:"url"`
+	Status         int         `json:"status"`
+	TTFBMs         int64       `json:"ttfb_ms"`
+	DurationMs     int64       `json:"duration_ms"`
+	RequestHeader  http.Header `json:"request_header"`
+	Request        interface{} `json:"request,omitempty"`
+	ResponseHeader http.Header `json:"response_header"`
+	Response       interface{} `json:"response,omitempty"`
+	Events         []dumpEvent `json:"events,omitempty"`
+	Summary        *llmSummary `json:"summary,omitempty"`
+}
+
+type dumpEvent struct {
+	AtMs  int64       `json:"at_ms"`
+	Event string      `json:"event,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+func newDumpRecord(ex *exchange, rd *redactor) *dumpRecord {
+	rec := &dumpRecord{
+		ID:             ex.id,
+		Time:           ex.start,
+		Method:         ex.method,
+		Path:           ex.path,
+		Query:          rd.RawQuery(ex.query),
+		Upstream:       ex.upstream,
+		URL:            ex.url,
+		Status:         ex.status,
+		TTFBMs:         ex.ttfb.Milliseconds(),
+		DurationMs:     ex.duration.Milliseconds(),
+		RequestHeader:  rd.Header(ex.reqHeader),
+		Request:        jsonOrString(rd.Text(string(ex.reqBody))),
+		ResponseHeader: rd.Header(ex.respHeader),
+		Summary:        ex.summary,
+	}
+	if ex.stream {
+		rec.Events = make([]dumpEvent, 0, len(ex.events))
+		for _, ev := range ex.events {
+			rec.Events = append(rec.Events, dumpEvent{AtMs: ev.At.Milliseconds(), Event: ev.Name, Data: jsonOrString(rd.Text(ev.Data))})
+		}
+	} else {
+		rec.Response = jsonOrString(rd.Text(string(decodedBody(ex.respHeader, ex.body.Bytes()))))
+	}
+	return rec
+}
+
+func jsonOrString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	return s
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errFaultDrop is returned by faultWriter once the injected drop or hang
+// happened, errFaultEnd once an injected error event ended the stream.
+var (
+	errFaultDrop = errors.New("connection dropped by fault injection")
+	errFaultEnd  = errors.New("stream ended by fault injection")
+)
+
+// faultAPIs maps the API names of FaultMatch to the protocols of decode.go.
+var faultAPIs = map[string]string{
+	"chat":      protoChat,
+	"messages":  protoMessages,
+	"gemini":    protoGemini,
+	"responses": protoResponses,
+}
+
+// FaultRule degrades matching requests. The first matching rule applies. The
+// schema is the one of the mock server's -faults file, so rules can move
+// between the two.
+type FaultRule struct {
+	Name  string     `yaml:"name"`
+	Match FaultMatch `yaml:"match"`
+
+	// Errors maps a status code to the fraction of requests answered with
+	// it, without contacting the upstream, e.g. {429: 0.1, 503: 0.05}.
+	Errors map[int]float64 `yaml:"errors"`
+	// RetryAfter is sent with injected 429, 503 and 529 errors. Defaults to
+	// 1s; negative omits the header.
+	RetryAfter time.Duration `yaml:"retry_after"`
+
+	// Rate is the fraction of the remaining matching requests that get the
+	// faults below. Defaults to 1.
+	Rate                 *float64      `yaml:"rate"`
+	Latency              time.Duration `yaml:"latency"`                // before forwarding
+	SlowChunks           time.Duration `yaml:"slow_chunks"`            // before every SSE event or body write
+	Hang                 bool          `yaml:"hang"`                   // never answer until the client gives up
+	HangAfterChunks      int           `yaml:"hang_after_chunks"`      // stop a stream after N events, keeping the connection open
+	FailAfterChunks      int           `yaml:"fail_after_chunks"`      // end a stream with an error event after N events
+	FailStatus           int           `yaml:"fail_status"`            // status of that error event, default 500
+	MalformedAfterChunks int           `yaml:"malformed_after_chunks"` // send an event of broken JSON after N events
+	DropAfterChunks      int           `yaml:"drop_after_chunks"`      // abort the connection after N events
+	TruncateJSON         bool          `yaml:"truncate_json"`          // cut bodies, or the event at the drop, in half
+}
+
+// FaultMatch conditions must all hold; empty ones are ignored.
+type FaultMatch struct {
+	API        string            `yaml:"api"`         // chat, messages, gemini or responses
+	PathPrefix string            `yaml:"path_prefix"` // request path prefix
+	Model      string            `yaml:"model"`       // glob, e.g. "gpt-4o*"
+	Headers    map[string]string `yaml:"headers"`     // header value globs, e.g. {X-Test-Case: "retry-*"}
+}
+
+func (f *FaultRule) validate() error {
+	if _, ok := faultAPIs[f.Match.API]; !ok && f.Match.API != "" {
+		return fmt.Errorf("match.api %q: want chat, messages, gemini or responses", f.Match.API)
+	}
+	if _, err := path.Match(f.Match.Model, ""); err != nil {
+		return fmt.Errorf("match.model: %w", err)
+	}
+	for name, pattern := range f.Match.Headers {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("match.headers[%s]: %w", name, err)
+		}
+	}
+	total := 0.0
+	for code, rate := range f.Errors {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("errors: status %d is not an error status", code)
+		}
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("errors: rate %v for %d is outside [0, 1]", rate, code)
+		}
+		total += rate
+	}
+	if total > 1 {
+		return fmt.Errorf("errors: rates add up to %v, more than 1", total)
+	}
+	if f.Rate != nil && (*f.Rate < 0 || *f.Rate > 1) {
+		return fmt.Errorf("rate %v is outside [0, 1]", *f.Rate)
+	}
+	if f.HangAfterChunks < 0 || f.FailAfterChunks < 0 || f.MalformedAfterChunks < 0 || f.DropAfterChunks < 0 {
+		return fmt.Errorf("chunk counts must not be negative")
+	}
+	if f.FailStatus != 0 && (f.FailStatus < 400 || f.FailStatus > 599) {
+		return fmt.Errorf("fail_status %d is not an error status", f.FailStatus)
+	}
+	if f.FailStatus == 0 {
+		f.FailStatus = http.StatusInternalServerError
+	}
+	return nil
+}
+
+func (m *FaultMatch) matches(r *http.Request, proto, model string) bool {
+	if m.API != "" && faultAPIs[m.API] != proto {
+		return false
+	}
+	if m.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, m.PathPrefix) {
+		return false
+	}
+	if m.Model != "" {
+		if ok, _ := path.Match(m.Model, model); !ok {
+			return false
+		}
+	}
+	for name, pattern := range m.Headers {
+		if ok, _ := path.Match(pattern, r.Header.Get(name)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchFault returns the first fault rule matching the request, or nil.
+// proto is the protocol the client speaks, see detectProtocol.
+func (c *ProxyConfig) MatchFault(r *http.Request, proto, model string) *FaultRule {
+	for i := range c.Faults {
+		if f := &c.Faults[i]; f.Match.matches(r, proto, model) {
+			return f
+		}
+	}
+	return nil
+}
+
+// rollError picks an injected error status, or 0 for none.
+func (f *FaultRule) rollError() int {
+	x := rand.Float64()
+	for code, rate := range f.Errors {
+		if x < rate {
+			return code
+		}
+		x -= rate
+	}
+	return 0
+}
+
+// rollDegrade reports whether the latency, hang and response faults apply
+// this time.
+func (f *FaultRule) rollDegrade() bool {
+	if f.Latency == 0 && f.SlowChunks == 0 && !f.Hang && f.HangAfterChunks == 0 && f.FailAfterChunks == 0 &&
+		f.MalformedAfterChunks == 0 && f.DropAfterChunks == 0 && !f.TruncateJSON {
+		return false
+	}
+	return f.Rate == nil || rand.Float64() < *f.Rate
+}
+
+func (f *FaultRule) String() string {
+	var parts []string
+	if f.Latency > 0 {
+		parts = append(parts, "latency="+f.Latency.String())
+	}
+	if f.SlowChunks > 0 {
+		parts = append(parts, "slow_chunks="+f.SlowChunks.String())
+	}
+	if f.Hang {
+		parts = append(parts, "hang")
+	}
+	if f.HangAfterChunks > 0 {
+		parts = append(parts, fmt.Sprintf("hang_after_chunks=%d", f.HangAfterChunks))
+	}
+	if f.FailAfterChunks > 0 {
+		parts = append(parts, fmt.Sprintf("fail_after_chunks=%d fail_status=%d", f.FailAfterChunks, f.FailStatus))
+	}
+	if f.MalformedAfterChunks > 0 {
+		parts = append(parts, fmt.Sprintf("malformed_after_chunks=%d", f.MalformedAfterChunks))
+	}
+	if f.DropAfterChunks > 0 {
+		parts = append(parts, fmt.Sprintf("drop_after_chunks=%d", f.DropAfterChunks))
+	}
+	if f.TruncateJSON {
+		parts = append(parts, "truncate_json")
+	}
+	return strings.Join(parts, " ")
+}
+
+// sleepCtx waits for d, returning false early when ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// faultError is the error body of an injected status in the shape of the
+// client's protocol, and the SSE event name it is sent under mid-stream.
+func faultError(proto string, status int) (string, interface{}) {
+	text := http.StatusText(status)
+	switch {
+	case status == 529: // Anthropic's
+		text = "Overloaded"
+	case text == "":
+		text = "Error"
+	}
+	msg := fmt.Sprintf("injected fault: %d %s", status, text)
+	switch proto {
+	case protoMessages:
+		return "error", map[string]interface{}{
+			"type":  "error",
+			"error": map[string]interface{}{"type": "injected_fault", "message": msg},
+		}
+	case protoGemini:
+		return "", map[string]interface{}{
+			"error": map[string]interface{}{"code": status, "message": msg, "status": "INJECTED_FAULT"},
+		}
+	case protoResponses:
+		return "error", map[string]interface{}{"type": "error", "code": "injected_fault", "message": msg, "param": nil}
+	}
+	return "", map[string]interface{}{
+		"error": map[string]interface{}{"message": msg, "type": "injected_fault", "code": strconv.Itoa(status)},
+	}
+}
+
+// writeFaultError answers with an injected error in the client's protocol.
+func writeFaultError(w http.ResponseWriter, f *FaultRule, proto string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable || status == 529 {
+		switch {
+		case f.RetryAfter == 0:
+			w.Header().Set("Retry-After", "1")
+		case f.RetryAfter > 0:
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(f.RetryAfter.Seconds()))))
+		}
+	}
+	w.WriteHeader(status)
+	_, body := faultError(proto, status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// faultWriter applies the response faults of a rule to whatever is written
+// through it. SSE bodies are re-split into events so that delays, errors and
+// drops land on event boundaries; plain bodies are held back when they have
+// to be truncated.
+type faultWriter struct {
+	http.ResponseWriter
+	rule      *FaultRule
+	ctx       context.Context
+	proto     string // the client's protocol, for the shape of error events
+	stream    bool
+	parser    *sseParser
+	events    int
+	held      bytes.Buffer
+	malformed bool // the broken event has been sent
+	ended     bool // an injected error event ended the stream
+	dropped   bool // the connection is to be aborted
+}
+
+func newFaultWriter(w http.ResponseWriter, r *http.Request, rule *FaultRule, proto string) *faultWriter {
+	fw := &faultWriter{ResponseWriter: w, rule: rule, ctx: r.Context(), proto: proto}
+	fw.parser = &sseParser{onEvent: fw.writeEvent}
+	return fw
+}
+
+func (fw *faultWriter) WriteHeader(status int) {
+	fw.stream = isEventStream(fw.Header())
+	if fw.rule.TruncateJSON || fw.stream {
+		fw.Header().Del("Content-Length")
+	}
+	fw.ResponseWriter.WriteHeader(status)
+}
+
+func (fw *faultWriter) Write(b []byte) (int, error) {
+	if err := fw.err(); err != nil {
+		return 0, err
+	}
+	switch {
+	case fw.stream:
+		fw.parser.Write(b)
+	case fw.rule.TruncateJSON:
+		fw.held.Write(b)
+	default:
+		if !sleepCtx(fw.ctx, fw.rule.SlowChunks) {
+			return 0, fw.ctx.Err()
+		}
+		if _, err := fw.ResponseWriter.Write(b); err != nil {
+			return 0, err
+		}
+	}
+	if err := fw.err(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (fw *faultWriter) err() error {
+	switch {
+	case fw.dropped:
+		return errFaultDrop
+	case fw.ended:
+		return errFaultEnd
+	}
+	return nil
+}
+
+func (fw *faultWriter) writeEvent(raw string) {
+	f := fw.rule
+	if fw.err() != nil {
+		return
+	}
+	if !sleepCtx(fw.ctx, f.SlowChunks) {
+		fw.dropped = true
+		return
+	}
+	switch {
+	case f.HangAfterChunks > 0 && fw.events == f.HangAfterChunks:
+		<-fw.ctx.Done()
+		fw.dropped = true
+		return
+	case f.FailAfterChunks > 0 && fw.events == f.FailAfterChunks:
+		event, body := faultError(fw.proto, f.FailStatus)
+		b, _ := json.Marshal(body)
+		if event != "" {
+			fw.ResponseWriter.Write([]byte("event: " + event + "\n"))
+		}
+		fw.ResponseWriter.Write([]byte("data: " + string(b) + "\n\n"))
+		fw.Flush()
+		fw.ended = true
+		return
+	case f.DropAfterChunks > 0 && fw.events == f.DropAfterChunks:
+		if f.TruncateJSON {
+			fw.ResponseWriter.Write([]byte(raw[:len(raw)/2]))
+		}
+		fw.Flush()
+		fw.dropped = true
+		return
+	case f.MalformedAfterChunks > 0 && fw.events == f.MalformedAfterChunks && !fw.malformed:
+		ev := parseSSEEvent(raw, 0)
+		if ev.Name != "" {
+			fw.ResponseWriter.Write([]byte("event: " + ev.Name + "\n"))
+		}
+		fw.ResponseWriter.Write([]byte("data: " + ev.Data[:len(ev.Data)/2] + "\n\n"))
+		fw.malformed = true
+	}
+	fw.ResponseWriter.Write([]byte(raw + "\n\n"))
+	fw.Flush()
+	fw.events++
+}
+
+func (fw *faultWriter) Flush() {
+	if f, ok := fw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes out what is still held back: the unterminated tail of a
+// stream, or the first half of a truncated body.
+func (fw *faultWriter) Close() {
+	if fw.err() != nil {
+		return
+	}
+	if fw.stream {
+		fw.parser.Flush()
+		return
+	}
+	if fw.rule.TruncateJSON {
+		body := fw.held.Bytes()
+		fw.ResponseWriter.Write(body[:len(body)/2])
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// hopHeaders apply to a single connection and must not be forwarded
+// (RFC 9110 section 7.6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders deletes hop-by-hop headers, including those named in
+// Connection, from h.
+func removeHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// joinURL appends reqPath to the path of base, so an origin such as
+// https://host/openai keeps its prefix, and uses rawQuery as the query.
+func joinURL(base *url.URL, reqPath, rawQuery string) string {
+	u := *base
+	u.Path = strings.TrimSuffix(base.Path, "/") + "/" + strings.TrimPrefix(reqPath, "/")
+	u.RawPath = ""
+	u.RawQuery = rawQuery
+	return u.String()
+}
+
+// parseBaseURL accepts absolute http(s) URLs only.
+func parseBaseURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute http(s) URL", s)
+	}
+	return u, nil
+}
+
+// clientOptions configure the upstream HTTP client.
+type clientOptions struct {
+	connectTimeout time.Duration // TCP connect and TLS handshake, each
+	headerTimeout  time.Duration // until the upstream sends response headers
+	timeout        time.Duration // whole exchange including the body, 0 for none
+	insecure       bool
+	caCert         string
+	proxyURL       string // empty uses HTTP_PROXY / HTTPS_PROXY / NO_PROXY
+}
+
+// newUpstreamClient builds the client used for forwarding. Unlike
+// http.DefaultClient it bounds connecting and waiting for headers but leaves
+// streamed bodies unbounded unless timeout is set, and never follows
+// redirects so they reach the client as sent.
+func newUpstreamClient(opts clientOptions) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if opts.proxyURL != "" {
+		u, err := url.Parse(opts.proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("upstream proxy: %w", err)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.insecure}
+	if opts.caCert != "" {
+		pem, err := os.ReadFile(opts.caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           (&net.Dialer{Timeout: opts.connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   opts.connectTimeout,
+		ResponseHeaderTimeout: opts.headerTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   20,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   opts.timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
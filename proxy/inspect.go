@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inspector keeps the most recent exchanges for the /_inspect web UI. A nil
+// inspector records nothing.
+type inspector struct {
+	mu       sync.Mutex
+	max      int
+	done     []*dumpRecord // oldest first
+	inflight map[uint64]*dumpRecord
+	config   *ProxyConfig
+}
+
+func newInspector(max int, config *ProxyConfig) *inspector {
+	return &inspector{max: max, inflight: make(map[uint64]*dumpRecord), config: config}
+}
+
+// Begin lists ex as in flight and follows its response as it arrives.
+func (in *inspector) Begin(ex *exchange, rd *redactor) {
+	if in == nil {
+		return
+	}
+	in.snapshot(ex, rd)
+	ex.progress = func(ev *sseEvent) {
+		if ev == nil {
+			in.snapshot(ex, rd)
+			return
+		}
+		e := dumpEvent{AtMs: ev.At.Milliseconds(), Event: ev.Name, Data: jsonOrString(rd.Text(ev.Data))}
+		in.mu.Lock()
+		if rec := in.inflight[ex.id]; rec != nil {
+			rec.Events = append(rec.Events, e)
+		}
+		in.mu.Unlock()
+	}
+}
+
+// snapshot replaces the in-flight entry of ex with its current state. It is
+// called from the goroutine serving ex, so ex is not read concurrently.
+func (in *inspector) snapshot(ex *exchange, rd *redactor) {
+	rec := newDumpRecord(ex, rd)
+	if ex.model != "" {
+		rec.Summary = &llmSummary{Model: ex.model}
+	}
+	in.mu.Lock()
+	in.inflight[ex.id] = rec
+	in.mu.Unlock()
+}
+
+// Done replaces the in-flight entry with the finished record.
+func (in *inspector) Done(ex *exchange, rd *redactor) {
+	if in == nil {
+		return
+	}
+	rec := newDumpRecord(ex, rd)
+	if rec.Summary == nil && ex.model != "" {
+		rec.Summary = &llmSummary{Model: ex.model}
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	delete(in.inflight, ex.id)
+	in.done = append(in.done, rec)
+	if len(in.done) > in.max {
+		in.done = in.done[len(in.done)-in.max:]
+	}
+}
+
+// inspectItem is one row of the exchange list.
+type inspectItem struct {
+	ID         uint64    `json:"id"`
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Upstream   string    `json:"upstream"`
+	Model      string    `json:"model"`
+	Status     int       `json:"status"`
+	DurationMs int64     `json:"duration_ms"`
+	Stream     bool      `json:"stream"`
+	Pending    bool      `json:"pending"`
+	Tokens     int       `json:"tokens"`
+	Preview    string    `json:"preview"`
+}
+
+func itemOf(rec *dumpRecord, pending bool) inspectItem {
+	it := inspectItem{
+		ID: rec.ID, Time: rec.Time, Method: rec.Method, Path: rec.Path, Upstream: rec.Upstream,
+		Model: rec.model(), Status: rec.Status, DurationMs: rec.DurationMs, Pending: pending,
+	}
+	if pending {
+		it.DurationMs = time.Since(rec.Time).Milliseconds()
+	}
+	if s := rec.Summary; s != nil {
+		it.Stream = s.Stream
+		it.Tokens = s.Usage.Total
+		it.Preview = s.Text
+		if s.Error != "" {
+			it.Preview = s.Error
+		}
+		if r := []rune(it.Preview); len(r) > 120 {
+			it.Preview = string(r[:120]) + "..."
+		}
+	}
+	return it
+}
+
+// ServeList returns the newest exchanges first, in-flight ones on top.
+func (in *inspector) ServeList(w http.ResponseWriter, r *http.Request) {
+	in.mu.Lock()
+	items := make([]inspectItem, 0, len(in.inflight)+len(in.done))
+	for _, rec := range in.inflight {
+		items = append(items, itemOf(rec, true))
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID > items[j].ID })
+	for i := len(in.done) - 1; i >= 0; i-- {
+		items = append(items, itemOf(in.done[i], false))
+	}
+	in.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// ServeExchange returns one exchange with ready-made commands. Exchanges in
+// flight show what has arrived so far.
+func (in *inspector) ServeExchange(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	in.mu.Lock()
+	var rec *dumpRecord
+	for _, d := range in.done {
+		if d.ID == id {
+			rec = d
+			break
+		}
+	}
+	pending := false
+	if live := in.inflight[id]; rec == nil && live != nil {
+		c := *live // copied, the serving goroutine keeps appending events
+		c.Events = append([]dumpEvent(nil), live.Events...)
+		rec, pending = &c, true
+	}
+	in.mu.Unlock()
+	if rec == nil {
+		http.Error(w, "exchange not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"record":      rec,
+		"pending":     pending,
+		"curl":        curlCommand(rec),
+		"fastllmcurl": in.fastllmcurlCommand(rec),
+	})
+}
+
+func (in *inspector) ServePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(inspectPage))
+}
+
+// shellQuote single-quotes s for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// curlCommand reproduces the forwarded request against the upstream.
+// Redacted credentials become $API_KEY.
+func curlCommand(rec *dumpRecord) string {
+	target := rec.URL
+	if rec.Query != "" {
+		target += "?" + rec.Query
+	}
+	parts := []string{"curl", "-X", rec.Method, shellQuote(target)}
+
+	names := make([]string, 0, len(rec.RequestHeader))
+	for name := range rec.RequestHeader {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Accept-Encoding", "Host", "User-Agent":
+			continue
+		}
+		for _, v := range rec.RequestHeader[name] {
+			if strings.Contains(v, redacted) {
+				scheme := ""
+				if i := strings.IndexByte(v, ' '); i > 0 && !strings.HasPrefix(v, redacted) {
+					scheme = v[:i+1]
+				}
+				parts = append(parts, "-H", shellQuote(name+": "+scheme)+`"$API_KEY"`)
+				continue
+			}
+			parts = append(parts, "-H", shellQuote(name+": "+v))
+		}
+	}
+	if body := bodyText(rec.Request); body != "" {
+		parts = append(parts, "--data-raw", shellQuote(body))
+	}
+	return strings.Join(parts, " ")
+}
+
+// fastllmcurlCommand builds the equivalent fastllmcurl call. The provider is
+// the route's upstream, or the upstream whose base URL has the same host.
+func (in *inspector) fastllmcurlCommand(rec *dumpRecord) string {
+	if rec.Summary == nil {
+		return ""
+	}
+	typ := map[string]string{
+		protoChat:      "chat",
+		protoMessages:  "message",
+		protoGemini:    "gemini",
+		protoResponses: "response",
+	}[rec.Summary.Protocol]
+	if typ == "" {
+		return ""
+	}
+
+	provider := "<provider>"
+	if _, ok := in.config.Upstreams[rec.Upstream]; ok {
+		provider = rec.Upstream
+	} else if u, err := url.Parse(rec.URL); err == nil {
+		names := make([]string, 0, len(in.config.Upstreams))
+		for name := range in.config.Upstreams {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if b, err := url.Parse(in.config.Upstreams[name].BaseURL); err == nil && b.Host == u.Host {
+				provider = name
+				break
+			}
+		}
+	}
+
+	parts := []string{"fastllmcurl", "-p", provider, "-t", typ}
+	if typ == "gemini" {
+		parts = append(parts, "-m", shellQuote(rec.Summary.Model))
+		if rec.Summary.Stream {
+			parts = append(parts, "--stream")
+		}
+	}
+	return strings.Join(append(parts, "-d", shellQuote(bodyText(rec.Request))), " ")
+}
+
+const inspectPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>proxy inspector</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; margin: 0; display: flex; height: 100vh; font-size: 13px; }
+#list { width: 45%; overflow-y: auto; border-right: 1px solid #ddd; }
+#detail { flex: 1; overflow-y: auto; padding: 0 16px; }
+#filters { position: sticky; top: 0; background: #f6f8fa; padding: 8px; border-bottom: 1px solid #ddd; display: flex; gap: 6px; }
+#filters input { flex: 1; }
+table { border-collapse: collapse; width: 100%; }
+td { padding: 4px 6px; border-bottom: 1px solid #eee; vertical-align: top; }
+tr.row { cursor: pointer; }
+tr.row:hover, tr.sel { background: #eef4ff; }
+.ok { color: #1a7f37; } .err { color: #cf222e; } .pending { color: #9a6700; }
+.muted { color: #666; }
+pre { background: #f6f8fa; padding: 8px; overflow-x: auto; white-space: pre-wrap; word-break: break-all; }
+h3 { margin: 16px 0 6px; }
+button { margin-right: 6px; }
+.events td { font-family: monospace; font-size: 12px; }
+</style>
+</head>
+<body>
+<div id="list">
+  <div id="filters">
+    <input id="q" placeholder="filter: model, path, upstream or text">
+    <select id="status">
+      <option value="">all</option><option value="2">2xx</option><option value="4">4xx</option><option value="5">5xx</option><option value="p">in flight</option>
+    </select>
+    <label><input type="checkbox" id="live" checked> live</label>
+  </div>
+  <table><tbody id="rows"></tbody></table>
+</div>
+<div id="detail"><p class="muted">Select an exchange.</p></div>
+<script>
+let items = [], selected = null, following = false;
+const $ = id => document.getElementById(id);
+const esc = s => String(s ?? "").replace(/[&<>"]/g, c => ({"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"}[c]));
+const pretty = v => typeof v === "string" ? v : JSON.stringify(v, null, 2);
+
+async function refresh() {
+  items = await (await fetch("/_inspect/api/exchanges")).json();
+  render();
+  if (following) show(selected);
+}
+
+function render() {
+  const q = $("q").value.toLowerCase(), st = $("status").value;
+  $("rows").innerHTML = items.filter(it => {
+    if (st === "p" && !it.pending) return false;
+    if (st && st !== "p" && (it.pending || String(it.status)[0] !== st)) return false;
+    return !q || [it.model, it.path, it.upstream, it.preview].join(" ").toLowerCase().includes(q);
+  }).map(it => {
+    const cls = it.pending ? "pending" : it.status < 400 ? "ok" : "err";
+    return '<tr class="row' + (it.id === selected ? " sel" : "") + '" onclick="show(' + it.id + ')">' +
+      '<td class="muted">#' + it.id + '<br>' + new Date(it.time).toLocaleTimeString() + '</td>' +
+      '<td><b>' + esc(it.model || it.path) + '</b>' + (it.stream ? " (stream)" : "") + '<br><span class="muted">' + esc(it.method + " " + it.path + " → " + (it.upstream || "…")) + '</span>' +
+      (it.preview ? '<br>' + esc(it.preview) : '') + '</td>' +
+      '<td class="' + cls + '">' + (it.pending ? "…" : it.status) + '<br><span class="muted">' + it.duration_ms + 'ms' + (it.tokens ? "<br>" + it.tokens + " tok" : "") + '</span></td></tr>';
+  }).join("");
+}
+
+async function show(id) {
+  selected = id;
+  render();
+  const resp = await fetch("/_inspect/api/exchanges/" + id);
+  if (!resp.ok) { following = false; $("detail").innerHTML = "<p>" + esc(await resp.text()) + "</p>"; return; }
+  const d = await resp.json(), rec = d.record, s = rec.summary;
+  following = d.pending;
+  let html = "<h2>#" + rec.id + " " + esc(rec.method + " " + rec.path) + " → " + (d.pending ? "…" : rec.status) + "</h2>" +
+    '<p class="muted">' + esc(rec.url) + " · " + esc(rec.upstream) + (d.pending ? " · in flight" : " · headers after " + rec.ttfb_ms + "ms · done after " + rec.duration_ms + "ms") + "</p>" +
+    '<p><button onclick="copy(\'curl\')">copy as curl</button>' + (d.fastllmcurl ? '<button onclick="copy(\'fastllmcurl\')">copy as fastllmcurl</button>' : "") + '<span id="copied" class="muted"></span></p>';
+  if (s) {
+    html += "<h3>Summary</h3><pre>" + esc(s.protocol + " model=" + s.model + " finish_reason=" + (s.finish_reason || "") +
+      " usage in=" + s.usage.input + " out=" + s.usage.output + " total=" + s.usage.total) +
+      (s.tool_calls || []).map(tc => "\ntool_call: " + esc(tc.name + "(" + tc.arguments + ")")).join("") +
+      (s.error ? "\nerror: " + esc(s.error) : "") + "</pre>";
+    if (s.thinking) html += "<h3>Thinking</h3><pre>" + esc(s.thinking) + "</pre>";
+    if (s.text) html += "<h3>Text</h3><pre>" + esc(s.text) + "</pre>";
+  }
+  html += "<h3>Request</h3><pre>" + esc(pretty(rec.request_header)) + "</pre><pre>" + esc(pretty(rec.request)) + "</pre>";
+  html += "<h3>Response</h3><pre>" + esc(pretty(rec.response_header)) + "</pre>";
+  if (rec.events) {
+    html += '<table class="events"><tbody>' + rec.events.map(ev =>
+      '<tr><td class="muted">+' + ev.at_ms + 'ms</td><td>' + esc(ev.event || "") + '</td><td>' + esc(typeof ev.data === "string" ? ev.data : JSON.stringify(ev.data)) + '</td></tr>').join("") + "</tbody></table>";
+  } else {
+    html += "<pre>" + esc(pretty(rec.response)) + "</pre>";
+  }
+  $("detail").innerHTML = html;
+  window.commands = d;
+}
+
+async function copy(kind) {
+  await navigator.clipboard.writeText(window.commands[kind]);
+  $("copied").textContent = "copied";
+  setTimeout(() => $("copied").textContent = "", 1500);
+}
+
+$("q").oninput = render;
+$("status").onchange = render;
+setInterval(() => $("live").checked && refresh(), 1000);
+refresh();
+</script>
+</body>
+</html>
+`
+
+const defaultInspectSize = 500
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultBudgetWindow = 24 * time.Hour
+
+// LimitConfig is the limits section of -config. The inline policy applies to
+// every client; entries in Clients override its non-zero fields for one
+// client.
+type LimitConfig struct {
+	// Key identifies clients: "api_key" (the default) uses the credential the
+	// client sends, "header:<Name>" the value of that header.
+	Key         string `yaml:"key"`
+	LimitPolicy `yaml:",inline"`
+	Clients     map[string]LimitPolicy `yaml:"clients"`
+
+	header string
+}
+
+// LimitPolicy is a request rate, a token rate and a token budget, each
+// disabled when zero. Tokens are counted from the usage upstreams report.
+type LimitPolicy struct {
+	RequestsPerMinute float64       `yaml:"requests_per_minute"`
+	Burst             int           `yaml:"burst"` // default requests_per_minute
+	TokensPerMinute   float64       `yaml:"tokens_per_minute"`
+	Budget            int64         `yaml:"budget"`        // tokens per budget_window
+	BudgetWindow      time.Duration `yaml:"budget_window"` // default 24h
+}
+
+func (lc *LimitConfig) validate() error {
+	switch {
+	case lc.Key == "" || lc.Key == "api_key":
+	case strings.HasPrefix(lc.Key, "header:") && strings.TrimSpace(lc.Key[len("header:"):]) != "":
+		lc.header = strings.TrimSpace(lc.Key[len("header:"):])
+	default:
+		return fmt.Errorf("key %q: want api_key or header:<Name>", lc.Key)
+	}
+	if err := lc.LimitPolicy.validate(); err != nil {
+		return err
+	}
+	for name, p := range lc.Clients {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("clients[%s]: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (p LimitPolicy) validate() error {
+	if p.RequestsPerMinute < 0 || p.Burst < 0 || p.TokensPerMinute < 0 || p.Budget < 0 || p.BudgetWindow < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// Enabled reports whether any limit is configured.
+func (lc *LimitConfig) Enabled() bool {
+	return lc.LimitPolicy != (LimitPolicy{}) || len(lc.Clients) > 0
+}
+
+// policy returns the defaults with the client's overrides applied.
+func (lc *LimitConfig) policy(client string) LimitPolicy {
+	p := lc.LimitPolicy
+	if o, ok := lc.Clients[client]; ok {
+		if o.RequestsPerMinute != 0 {
+			p.RequestsPerMinute = o.RequestsPerMinute
+		}
+		if o.Burst != 0 {
+			p.Burst = o.Burst
+		}
+		if o.TokensPerMinute != 0 {
+			p.TokensPerMinute = o.TokensPerMinute
+		}
+		if o.Budget != 0 {
+			p.Budget = o.Budget
+		}
+		if o.BudgetWindow != 0 {
+			p.BudgetWindow = o.BudgetWindow
+		}
+	}
+	if p.Burst == 0 {
+		p.Burst = int(math.Max(1, math.Ceil(p.RequestsPerMinute)))
+	}
+	if p.BudgetWindow == 0 {
+		p.BudgetWindow = defaultBudgetWindow
+	}
+	return p
+}
+
+// limiter enforces the limits of one proxy. Its methods are no-ops on nil.
+type limiter struct {
+	cfg     *LimitConfig
+	mu      sync.Mutex
+	clients map[string]*clientLimits
+	swept   time.Time
+}
+
+// clientLimits holds two token buckets, one of requests and one of LLM
+// tokens, and the budget window. The LLM token bucket is charged after the
+// response and may go negative; requests are refused until it refills.
+type clientLimits struct {
+	policy      LimitPolicy
+	requests    float64
+	tokens      float64
+	last        time.Time
+	used        int64
+	windowStart time.Time
+}
+
+func newLimiter(cfg *LimitConfig) *limiter {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &limiter{cfg: cfg, clients: make(map[string]*clientLimits)}
+}
+
+// ClientKey identifies the client of r.
+func (l *limiter) ClientKey(r *http.Request) string {
+	if l == nil {
+		return ""
+	}
+	if l.cfg.header != "" {
+		return r.Header.Get(l.cfg.header)
+	}
+	return clientCredential(r)
+}
+
+// apiKeyHeaders carry API keys besides Authorization: Anthropic's, Azure's
+// and Google's.
+var apiKeyHeaders = []string{"X-Api-Key", "Api-Key", "X-Goog-Api-Key"}
+
+// clientCredential returns the API key r was sent with, in whichever of the
+// supported headers or the key query parameter it came.
+func clientCredential(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	for _, name := range apiKeyHeaders {
+		if v := r.Header.Get(name); v != "" {
+			return v
+		}
+	}
+	return r.URL.Query().Get("key")
+}
+
+// describe names a client in logs and errors without revealing API keys.
+func (l *limiter) describe(client string) string {
+	switch {
+	case client == "":
+		return "anonymous client"
+	case l.cfg.header != "":
+		return fmt.Sprintf("client %q", client)
+	}
+	return "API key " + maskSecret(client)
+}
+
+// evictIdle forgets clients whose limits have fully recovered, so that the
+// map does not keep every key ever seen. It runs at most once a minute.
+func (l *limiter) evictIdle(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for client, c := range l.clients {
+		if c.recovered(now) {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// recovered reports whether c is back to the state of a new client: both
+// buckets full again and the budget window over.
+func (c *clientLimits) recovered(now time.Time) bool {
+	idle := now.Sub(c.last)
+	p := c.policy
+	if idle < p.BudgetWindow {
+		return false
+	}
+	if p.RequestsPerMinute > 0 && c.requests+idle.Minutes()*p.RequestsPerMinute < float64(p.Burst) {
+		return false
+	}
+	if p.TokensPerMinute > 0 && c.tokens+idle.Minutes()*p.TokensPerMinute < p.TokensPerMinute {
+		return false
+	}
+	return true
+}
+
+func (l *limiter) state(client string, now time.Time) *clientLimits {
+	c := l.clients[client]
+	if c == nil {
+		p := l.cfg.policy(client)
+		c = &clientLimits{policy: p, requests: float64(p.Burst), tokens: p.TokensPerMinute, last: now, windowStart: now}
+		l.clients[client] = c
+	}
+	elapsed := now.Sub(c.last).Minutes()
+	c.last = now
+	c.requests = math.Min(float64(c.policy.Burst), c.requests+elapsed*c.policy.RequestsPerMinute)
+	c.tokens = math.Min(c.policy.TokensPerMinute, c.tokens+elapsed*c.policy.TokensPerMinute)
+	if now.Sub(c.windowStart) >= c.policy.BudgetWindow {
+		c.used, c.windowStart = 0, now
+	}
+	return c
+}
+
+// limitExceeded describes why a request was refused.
+type limitExceeded struct {
+	retry  time.Duration
+	reason string
+	quota  bool // the budget, rather than a rate, is used up
+}
+
+// Allow takes one request from the client's allowance, or reports which
+// limit is exceeded.
+func (l *limiter) Allow(client string) *limitExceeded {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.evictIdle(now)
+	c := l.state(client, now)
+	p := c.policy
+
+	if p.Budget > 0 && c.used >= p.Budget {
+		return &limitExceeded{c.windowStart.Add(p.BudgetWindow).Sub(now), fmt.Sprintf("token budget of %d per %s used up", p.Budget, p.BudgetWindow), true}
+	}
+	if p.TokensPerMinute > 0 && c.tokens <= 0 {
+		return &limitExceeded{minutes((1 - c.tokens) / p.TokensPerMinute), fmt.Sprintf("%g tokens per minute exceeded", p.TokensPerMinute), false}
+	}
+	if p.RequestsPerMinute > 0 {
+		if c.requests < 1 {
+			return &limitExceeded{minutes((1 - c.requests) / p.RequestsPerMinute), fmt.Sprintf("%g requests per minute exceeded", p.RequestsPerMinute), false}
+		}
+		c.requests--
+	}
+	return nil
+}
+
+// Record charges the tokens of a finished exchange to the client.
+func (l *limiter) Record(client string, tokens int) {
+	if l == nil || tokens <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.state(client, time.Now())
+	c.tokens -= float64(tokens)
+	c.used += int64(tokens)
+}
+
+// chargedTokens is what an exchange costs its client: the reported total,
+// which for Gemini also covers thoughts, or input plus output. Streams that
+// report no usage, such as OpenAI streams without
+// stream_options.include_usage, are estimated at four bytes per token of
+// request and streamed output, so leaving usage out does not dodge limits.
+func chargedTokens(ex *exchange) int {
+	s := ex.summary
+	if s == nil {
+		return 0
+	}
+	if n := max(s.Usage.Total, s.Usage.Input+s.Usage.Output); n > 0 {
+		return n
+	}
+	if !ex.stream || ex.status >= 400 {
+		return 0
+	}
+	size := len(ex.reqBody) + len(s.Text) + len(s.Thinking)
+	for _, tc := range s.ToolCalls {
+		size += len(tc.Name) + len(tc.Arguments)
+	}
+	return (size + 3) / 4
+}
+
+func minutes(m float64) time.Duration {
+	return time.Duration(m * float64(time.Minute))
+}
+
+// writeLimitError sends an OpenAI-style 429. Budgets use the
+// insufficient_quota error OpenAI returns when credit runs out.
+func writeLimitError(w http.ResponseWriter, who string, e *limitExceeded) {
+	typ := "rate_limit_exceeded"
+	if e.quota {
+		typ = "insufficient_quota"
+	}
+	secs := int(math.Ceil(math.Max(1, e.retry.Seconds())))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": fmt.Sprintf("Rate limit reached for %s: %s. Please try again in %ds.", who, e.reason, secs),
+			"type":    typ,
+			"code":    typ,
+		},
+	})
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the histogram upper bounds in seconds, shared by the
+// request duration and time-to-first-token histograms.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+type seriesKey struct {
+	Protocol string `json:"protocol"` // one of the proto* names or "other"
+	Upstream string `json:"upstream"`
+	Model    string `json:"model"`
+}
+
+type histogram struct {
+	Counts []uint64 `json:"counts"` // per bucket, not cumulative; the last one is +Inf
+	Sum    float64  `json:"sum"`
+	Count  uint64   `json:"count"`
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.Counts == nil {
+		h.Counts = make([]uint64, len(latencyBuckets)+1)
+	}
+	v := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+// series aggregates the exchanges sharing one protocol, upstream and model.
+type series struct {
+	seriesKey
+	Requests     uint64         `json:"requests"`
+	Statuses     map[int]uint64 `json:"statuses"`
+	Latency      histogram      `json:"latency_seconds"`
+	TTFT         histogram      `json:"ttft_seconds"` // streamed responses only
+	InputTokens  uint64         `json:"input_tokens"`
+	OutputTokens uint64         `json:"output_tokens"`
+}
+
+// maxModelLabels caps the distinct model label values. Models come from
+// client requests, so later ones are counted as "other".
+const maxModelLabels = 100
+
+// proxyMetrics backs /metrics and /stats.
+type proxyMetrics struct {
+	mu     sync.Mutex
+	start  time.Time
+	series map[seriesKey]*series
+	models map[string]bool
+}
+
+func newProxyMetrics() *proxyMetrics {
+	return &proxyMetrics{start: time.Now(), series: make(map[seriesKey]*series), models: make(map[string]bool)}
+}
+
+func (m *proxyMetrics) Observe(ex *exchange) {
+	key := seriesKey{Protocol: detectProtocol(ex.path, nil), Upstream: ex.upstream, Model: ex.model}
+	if ex.summary != nil {
+		key.Protocol = ex.summary.Protocol
+		if ex.summary.Model != "" {
+			key.Model = ex.summary.Model
+		}
+	}
+	if key.Protocol == "" {
+		key.Protocol = "other" // raw paths would give clients unbounded label values
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.models[key.Model] {
+		if len(m.models) < maxModelLabels {
+			m.models[key.Model] = true
+		} else {
+			key.Model = "other"
+		}
+	}
+	s := m.series[key]
+	if s == nil {
+		s = &series{seriesKey: key, Statuses: make(map[int]uint64)}
+		m.series[key] = s
+	}
+	s.Requests++
+	s.Statuses[ex.status]++
+	s.Latency.observe(ex.duration)
+	if ex.stream && len(ex.events) > 0 {
+		s.TTFT.observe(ex.events[0].At)
+	}
+	if ex.summary != nil {
+		s.InputTokens += uint64(ex.summary.Usage.Input)
+		s.OutputTokens += uint64(ex.summary.Usage.Output)
+	}
+}
+
+// sorted returns copies of all series ordered by their labels.
+func (m *proxyMetrics) sorted() []series {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]series, 0, len(m.series))
+	for _, s := range m.series {
+		c := *s
+		c.Statuses = make(map[int]uint64, len(s.Statuses))
+		for k, v := range s.Statuses {
+			c.Statuses[k] = v
+		}
+		c.Latency.Counts = append([]uint64(nil), s.Latency.Counts...)
+		c.TTFT.Counts = append([]uint64(nil), s.TTFT.Counts...)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].seriesKey, out[j].seriesKey
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Upstream != b.Upstream {
+			return a.Upstream < b.Upstream
+		}
+		return a.Model < b.Model
+	})
+	return out
+}
+
+// ServeMetrics writes the Prometheus text exposition format.
+func (m *proxyMetrics) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	all := m.sorted()
+	var b strings.Builder
+
+	b.WriteString("# HELP llm_proxy_start_time_seconds Unix time the proxy started.\n")
+	b.WriteString("# TYPE llm_proxy_start_time_seconds gauge\n")
+	fmt.Fprintf(&b, "llm_proxy_start_time_seconds %d\n", m.start.Unix())
+
+	b.WriteString("# HELP llm_proxy_requests_total Proxied requests by status.\n")
+	b.WriteString("# TYPE llm_proxy_requests_total counter\n")
+	for _, s := range all {
+		codes := make([]int, 0, len(s.Statuses))
+		for code := range s.Statuses {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(&b, "llm_proxy_requests_total{%s,status=\"%d\"} %d\n", s.labels(), code, s.Statuses[code])
+		}
+	}
+
+	b.WriteString("# HELP llm_proxy_tokens_total Tokens reported in response usage.\n")
+	b.WriteString("# TYPE llm_proxy_tokens_total counter\n")
+	for _, s := range all {
+		fmt.Fprintf(&b, "llm_proxy_tokens_total{%s,type=\"input\"} %d\n", s.labels(), s.InputTokens)
+		fmt.Fprintf(&b, "llm_proxy_tokens_total{%s,type=\"output\"} %d\n", s.labels(), s.OutputTokens)
+	}
+
+	writeHistogram(&b, "llm_proxy_request_duration_seconds", "Time until the response body was fully sent.", all, func(s *series) *histogram { return &s.Latency })
+	writeHistogram(&b, "llm_proxy_ttft_seconds", "Time until the first SSE event of streamed responses.", all, func(s *series) *histogram { return &s.TTFT })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+func writeHistogram(b *strings.Builder, name, help string, all []series, get func(*series) *histogram) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i := range all {
+		h := get(&all[i])
+		if h.Count == 0 {
+			continue
+		}
+		labels := all[i].labels()
+		var cum uint64
+		for j, bound := range latencyBuckets {
+			cum += h.Counts[j]
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), cum)
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.Count)
+		fmt.Fprintf(b, "%s_sum{%s} %g\n", name, labels, h.Sum)
+		fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels, h.Count)
+	}
+}
+
+func (s *series) labels() string {
+	return fmt.Sprintf("protocol=%s,upstream=%s,model=%s", promQuote(s.Protocol), promQuote(s.Upstream), promQuote(s.Model))
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promQuote quotes a label value for the text format, which only knows the
+// escapes \\, \" and \n.
+func promQuote(s string) string {
+	return `"` + promEscaper.Replace(s) + `"`
+}
+
+// statsTotal sums series for one model or upstream in /stats.
+type statsTotal struct {
+	Requests     uint64 `json:"requests"`
+	Errors       uint64 `json:"errors"` // status >= 400
+	InputTokens  uint64 `json:"input_tokens"`
+	OutputTokens uint64 `json:"output_tokens"`
+}
+
+func addTotal(totals map[string]*statsTotal, key string, s *series) {
+	t := totals[key]
+	if t == nil {
+		t = &statsTotal{}
+		totals[key] = t
+	}
+	t.Requests += s.Requests
+	t.InputTokens += s.InputTokens
+	t.OutputTokens += s.OutputTokens
+	for code, n := range s.Statuses {
+		if code >= 400 {
+			t.Errors += n
+		}
+	}
+}
+
+// ServeStats writes the same aggregates as JSON, with totals per model and
+// per upstream for a quick look without Prometheus.
+func (m *proxyMetrics) ServeStats(w http.ResponseWriter, r *http.Request) {
+	all := m.sorted()
+	byModel := make(map[string]*statsTotal)
+	byUpstream := make(map[string]*statsTotal)
+	for i := range all {
+		addTotal(byModel, all[i].Model, &all[i])
+		addTotal(byUpstream, all[i].Upstream, &all[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(map[string]interface{}{
+		"start":          m.start,
+		"uptime_seconds": int64(time.Since(m.start).Seconds()),
+		"buckets":        latencyBuckets,
+		"by_model":       byModel,
+		"by_upstream":    byUpstream,
+		"series":         all,
+	})
+}
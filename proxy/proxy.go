@@ -1,15 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
+	"os/signal"
+	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -18,79 +23,611 @@ var requestCounter uint64
 type dumpJob struct {
 	filename string
 	data     []byte
+	append   bool // append to filename instead of creating it
 }
 
 var dumpChan chan dumpJob
 
 func dumpWorker() {
 	for job := range dumpChan {
-		os.WriteFile(job.filename, job.data, 0644)
+		if !job.append {
+			os.WriteFile(job.filename, job.data, 0644)
+			continue
+		}
+		f, err := os.OpenFile(job.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			log.Printf("dump: %v", err)
+			continue
+		}
+		f.Write(job.data)
+		f.Close()
+	}
+}
+
+// exchange holds everything captured for one proxied request.
+type exchange struct {
+	id         uint64
+	upstream   string
+	model      string // requested model, when the request names one
+	url        string // upstream URL, without the query
+	start      time.Time
+	method     string
+	path       string
+	query      string
+	reqHeader  http.Header
+	reqBody    []byte
+	reqDump    []byte
+	respHeader http.Header
+	respHead   []byte
+	status     int
+	ttfb       time.Duration // time until the response headers arrived
+	stream     bool
+	body       bytes.Buffer // non-SSE response body
+	events     []sseEvent   // SSE response events, in arrival order
+	duration   time.Duration
+	summary    *llmSummary // decoded LLM view, nil for other traffic
+
+	progress func(ev *sseEvent) // set by the inspector to follow the exchange live
+}
+
+// notify reports progress of the exchange: its response headers when ev is
+// nil, else one more SSE event.
+func (e *exchange) notify(ev *sseEvent) {
+	if e.progress != nil {
+		e.progress(ev)
+	}
+}
+
+// dump renders the exchange in the plain-text dump file format. SSE events
+// are prefixed with their arrival offset. reqDump and respHead are already
+// redacted; bodies are redacted here.
+func (e *exchange) dump(rd *redactor) []byte {
+	var b bytes.Buffer
+	b.Write(e.reqDump)
+	b.WriteString("\n\n---\n\n")
+	b.Write(e.respHead)
+	if !e.stream {
+		b.WriteString(rd.Text(e.body.String()))
+		if e.summary != nil {
+			fmt.Fprintf(&b, "\n\n---\n\n%s\n", e.summary)
+		}
+		return b.Bytes()
+	}
+	for _, ev := range e.events {
+		fmt.Fprintf(&b, "[+%dms]\n%s\n\n", ev.At.Milliseconds(), rd.Text(ev.Raw))
+	}
+	fmt.Fprintf(&b, "[+%dms] stream closed, %d events\n", e.duration.Milliseconds(), len(e.events))
+	if e.summary != nil {
+		fmt.Fprintf(&b, "\n---\n\n%s\n", e.summary)
+	}
+	return b.Bytes()
+}
+
+// copyResponse forwards the upstream body to the client, flushing after every
+// read so streamed responses reach the client as they are generated. SSE
+// events are logged with their arrival offset as they pass through.
+func copyResponse(w http.ResponseWriter, resp *http.Response, ex *exchange, rd *redactor, quiet bool) error {
+	flusher, _ := w.(http.Flusher)
+
+	var parser *sseParser
+	if ex.stream {
+		parser = &sseParser{onEvent: func(raw string) {
+			ev := parseSSEEvent(raw, time.Since(ex.start))
+			ex.events = append(ex.events, ev)
+			ex.notify(&ev)
+			if !quiet {
+				fmt.Printf("[#%d +%dms] %s\n\n", ex.id, ev.At.Milliseconds(), rd.Text(raw))
+			}
+		}}
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			if parser != nil {
+				parser.Write(buf[:n])
+			} else {
+				ex.body.Write(buf[:n])
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if parser != nil {
+		parser.Flush()
 	}
+	return nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		os.Exit(runQuery(os.Args[2:]))
+	}
+
 	targetUrl := flag.String("origin", "", "Target URL")
 	port := flag.Int("p", 8000, "Port")
 	dump := flag.Bool("dump", false, "Dump each request/response to file in current dir")
+	dumpFormat := flag.String("dump-format", "txt", "Dump format: txt (one file per exchange) or jsonl (one line per exchange in -dump-file)")
+	dumpFile := flag.String("dump-file", defaultDumpFile, "File that -dump-format jsonl appends to")
+	redact := flag.Bool("redact", true, "Redact secrets and base64 payloads in logs and dumps")
+	redactHeaders := flag.String("redact-headers", defaultRedactHeaders, "Comma-separated headers to redact")
+	redactFields := flag.String("redact-fields", defaultRedactFields, "Comma-separated JSON fields and query parameters to redact")
+	redactBase64 := flag.Int("redact-base64", 256, "Replace base64 strings at least this long with hash and length, 0 to keep")
+	configPath := flag.String("config", "", "YAML routing config (upstreams and routes)")
+	providersPath := flag.String("providers", defaultProvidersPath(), "fastllmcurl providers.yaml whose entries can be used as upstreams")
+	recordDir := flag.String("record", "", "Record each exchange into this directory for -replay")
+	replayDir := flag.String("replay", "", "Serve recorded exchanges from this directory without contacting any upstream")
+	volatileFields := flag.String("replay-ignore", defaultVolatileFields, "Comma-separated JSON fields and query parameters left out of the record/replay key")
+	cacheOn := flag.Bool("cache", false, "Serve repeated identical requests from an in-memory response cache")
+	cacheTTL := flag.Duration("cache-ttl", defaultCacheTTL, "How long -cache keeps a response")
+	cacheSize := flag.Int("cache-size", defaultCacheSize, "Maximum size of -cache in MiB")
+	connectTimeout := flag.Duration("connect-timeout", 10*time.Second, "Upstream TCP connect and TLS handshake timeout")
+	headerTimeout := flag.Duration("header-timeout", 5*time.Minute, "How long to wait for upstream response headers, 0 for no limit")
+	timeout := flag.Duration("timeout", 0, "Limit for a whole upstream exchange including streamed bodies, 0 for no limit")
+	insecure := flag.Bool("insecure", false, "Skip upstream TLS certificate verification")
+	caCert := flag.String("ca-cert", "", "PEM file with extra CA certificates for upstream TLS")
+	upstreamProxy := flag.String("upstream-proxy", "", "HTTP(S) proxy for upstream connections (default from HTTPS_PROXY/HTTP_PROXY)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long to let in-flight requests finish on SIGINT/SIGTERM")
+	inspect := flag.Bool("inspect", false, "Serve a web inspector for recent exchanges at /_inspect")
+	inspectSize := flag.Int("inspect-size", defaultInspectSize, "Number of finished exchanges kept for -inspect")
+	summaryOnly := flag.Bool("summary-only", false, "Print only the decoded LLM summary instead of raw HTTP dumps")
 	flag.StringVar(targetUrl, "o", "https://api.ppinfra.com", "Target URL (shorthand)")
 	flag.Parse()
+	if *dumpFormat != "txt" && *dumpFormat != "jsonl" {
+		log.Fatalf("unknown -dump-format %q", *dumpFormat)
+	}
+	dumpDone := make(chan struct{})
 	if *dump {
 		dumpChan = make(chan dumpJob, 100)
-		go dumpWorker()
+		go func() {
+			dumpWorker()
+			close(dumpDone)
+		}()
+	}
+
+	target, err := parseBaseURL(*targetUrl)
+	if err != nil {
+		log.Fatalf("-origin: %v", err)
+	}
+	client, err := newUpstreamClient(clientOptions{
+		connectTimeout: *connectTimeout,
+		headerTimeout:  *headerTimeout,
+		timeout:        *timeout,
+		insecure:       *insecure,
+		caCert:         *caCert,
+		proxyURL:       *upstreamProxy,
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	target, _ := url.Parse(*targetUrl)
+	config, err := LoadProxyConfig(*configPath, *providersPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var rd *redactor
+	if *redact {
+		rd = newRedactor(*redactHeaders, *redactFields, *redactBase64)
+	}
+
+	// 凭证类参数(如 Gemini 的 ?key=)也不参与 key 计算
+	keyIgnore := ignoreSet(*volatileFields, defaultRedactFields)
+	if *recordDir != "" {
+		if err := os.MkdirAll(*recordDir, 0755); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var cache *responseCache
+	if *cacheOn {
+		cache = newResponseCache(*cacheTTL, int64(*cacheSize)<<20)
+	}
+
+	limits := newLimiter(&config.Limits)
+	stats := newProxyMetrics()
+	var ins *inspector
+	if *inspect {
+		ins = newInspector(*inspectSize, config)
+	}
+
+	// finish 打印响应体和摘要，记录指标并写 dump
+	finish := func(r *http.Request, ex *exchange) {
+		if !*summaryOnly {
+			if ex.stream {
+				fmt.Printf("=== Stream #%d closed (+%dms, %d events) ===\n", ex.id, ex.duration.Milliseconds(), len(ex.events))
+			} else {
+				fmt.Println(rd.Text(string(decodedBody(ex.respHeader, ex.body.Bytes()))))
+			}
+		}
+
+		// ---- 解析 LLM 协议摘要 ----
+		if ex.summary = summarize(ex); ex.summary != nil {
+			fmt.Printf("=== #%d %s %s -> %s %d (%dms) ===\n    %s\n", ex.id, r.Method, r.URL.Path, ex.upstream, ex.status, ex.duration.Milliseconds(), ex.summary)
+		} else if *summaryOnly {
+			fmt.Printf("=== #%d %s %s -> %s %d (%dms) ===\n", ex.id, r.Method, r.URL.Path, ex.upstream, ex.status, ex.duration.Milliseconds())
+		}
+
+		stats.Observe(ex)
+
+		switch {
+		case !*dump:
+		case *dumpFormat == "jsonl":
+			line, err := json.Marshal(newDumpRecord(ex, rd))
+			if err != nil {
+				fmt.Printf("=== Dump #%d error: %v ===\n", ex.id, err)
+				break
+			}
+			dumpChan <- dumpJob{*dumpFile, append(line, '\n'), true}
+		default:
+			dumpChan <- dumpJob{fmt.Sprintf("%s_%d_%d.txt", ex.start.Format("20060102_150405"), ex.id, ex.status), ex.dump(rd), false}
+		}
+	}
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		reqID := atomic.AddUint64(&requestCounter, 1)
-		timestamp := time.Now().Format("20060102_150405")
+		ex := &exchange{id: atomic.AddUint64(&requestCounter, 1), start: time.Now()}
 
 		// ---- 打印请求 ----
-		reqDump, _ := httputil.DumpRequest(r, true)
-		fmt.Println("\n=== Incoming Request ===")
-		fmt.Println(string(reqDump))
+		ex.method, ex.path, ex.query, ex.reqHeader = r.Method, r.URL.Path, r.URL.RawQuery, r.Header
+		ex.reqBody, _ = io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(ex.reqBody))
+		ex.reqDump = rd.DumpRequest(r, ex.reqBody)
+		if !*summaryOnly {
+			fmt.Println("\n=== Incoming Request ===")
+			fmt.Println(string(ex.reqDump))
+		}
+
+		var reqJSON map[string]interface{}
+		json.Unmarshal(ex.reqBody, &reqJSON)
+		model := requestModel(r.URL.Path, reqJSON)
+
+		clientKey := limits.ClientKey(r) // 改写可能替换凭证，先取客户端 key
+		credential := clientCredential(r)
+
+		// ---- 改写请求 ----
+		// 之后的回放 key、路由和转发都使用改写后的请求
+		if rules := config.MatchRewrites(r.URL.Path, model); len(rules) > 0 {
+			before := *r.URL
+			body, err := applyRewrites(r, ex.reqBody, rules)
+			if err != nil {
+				http.Error(w, "rewrite: "+err.Error(), 500)
+				return
+			}
+			bodyChanged := !bytes.Equal(body, ex.reqBody)
+			ex.reqBody = body
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			ex.path, ex.query = r.URL.Path, r.URL.RawQuery
+			reqJSON = nil
+			json.Unmarshal(body, &reqJSON)
+			rewritten := requestModel(r.URL.Path, reqJSON)
+			fmt.Printf("=== Rewritten #%d: %s ===\n", ex.id, describeRewrites(rd, rules, &before, r, model, rewritten, bodyChanged))
+			if bodyChanged && !*summaryOnly {
+				fmt.Println(rd.Text(string(body)))
+			}
+			model = rewritten
+		}
+		ex.model = model
+		ins.Begin(ex, rd)
+		defer ins.Done(ex, rd)
+
+		// ---- 限流 ----
+		// 请求速率、token 速率和 token 预算按客户端计算，token 在响应结束后按 usage 计入
+		if e := limits.Allow(clientKey); e != nil {
+			who := limits.describe(clientKey)
+			fmt.Printf("=== Limit #%d: %s, %s ===\n", ex.id, who, e.reason)
+			writeLimitError(w, who, e)
+			ex.upstream, ex.status, ex.duration = "limit", http.StatusTooManyRequests, time.Since(ex.start)
+			stats.Observe(ex)
+			return
+		}
+
+		// ---- 故障注入 ----
+		// 注入的错误直接返回；延迟、慢速 chunk、断流和截断作用于转发或回放的响应
+		// 延迟和挂起在客户端断开时立即结束
+		var fw *faultWriter
+		proto := detectProtocol(r.URL.Path, reqJSON)
+		if fault := config.MatchFault(r, proto, model); fault != nil {
+			if status := fault.rollError(); status != 0 {
+				fmt.Printf("=== Fault #%d: injected %d ===\n", ex.id, status)
+				writeFaultError(w, fault, proto, status)
+				ex.upstream, ex.status, ex.duration = "fault", status, time.Since(ex.start)
+				stats.Observe(ex)
+				return
+			}
+			if fault.rollDegrade() {
+				fmt.Printf("=== Fault #%d: %s ===\n", ex.id, fault)
+				if fault.Hang || !sleepCtx(r.Context(), fault.Latency) {
+					<-r.Context().Done()
+					ex.upstream, ex.status, ex.duration = "fault", 499, time.Since(ex.start)
+					stats.Observe(ex)
+					return
+				}
+				fw = newFaultWriter(w, r, fault, proto)
+				w = fw
+				defer func() {
+					if fw.dropped {
+						panic(http.ErrAbortHandler) // 不发送结束 chunk，客户端看到连接中断
+					}
+				}()
+			}
+		}
+
+		key := requestKey(r, ex.reqBody, keyIgnore)
+		lookup, store := cachePolicy(r.Header)
+		r.Header.Del(cacheHeader)
+
+		// ---- 选择上游 ----
+		// 按 path 前缀或 model 匹配路由，未命中则转发到 -origin
+		base, upstreamPath := target, r.URL.Path
+		ex.upstream = target.Host
+		var upstream *Upstream
+		rt := config.Match(r.URL.Path, model)
+		if rt != nil {
+			upstream = config.Upstreams[rt.Upstream]
+			base, _ = parseBaseURL(upstream.BaseURL) // validated when loading the config
+			upstreamPath = rt.UpstreamPath(r.URL.Path)
+			ex.upstream = rt.Upstream
+		}
+
+		// ---- 协议转换 ----
+		// OpenAI chat completions 请求转换为上游协议，之后的日志、dump 和 summary 使用转换后的请求
+		var tr chatTranslator
+		query := r.URL.RawQuery
+		if rt != nil && rt.Translate != "" && strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			tr = newTranslator(rt.Translate)
+			body, reqType, err := tr.Request(reqJSON)
+			if err != nil {
+				writeTranslateError(w, err)
+				ex.status, ex.duration = http.StatusBadRequest, time.Since(ex.start)
+				stats.Observe(ex)
+				return
+			}
+			upstreamPath, query = upstream.ProtocolPath(reqType, model)
+			if reqType == "gemini_stream" && !strings.Contains(query, "alt=") {
+				query = strings.TrimPrefix(query+"&alt=sse", "&")
+			}
+			ex.reqBody, _ = json.Marshal(body)
+			ex.path, ex.query = upstreamPath, query
+			fmt.Printf("=== Translated #%d: openai-chat -> %s %s ===\n", ex.id, rt.Translate, upstreamPath)
+			if !*summaryOnly {
+				fmt.Println(rd.Text(string(ex.reqBody)))
+			}
+		}
+		ex.url = joinURL(base, upstreamPath, "")
+
+		// serveStored 回放录制或缓存的响应，需要时同样转换为 OpenAI 格式
+		serveStored := func(rec *recording, timed bool) {
+			if tr != nil {
+				tw := newTranslateWriter(w, tr)
+				replay(tw, rec, ex, rd, *summaryOnly, timed)
+				tw.Close()
+			} else {
+				replay(w, rec, ex, rd, *summaryOnly, timed)
+			}
+			if fw != nil {
+				fw.Close()
+			}
+			ex.duration = time.Since(ex.start)
+		}
+
+		// ---- 回放 ----
+		// 命中录制则按原始时序回放，未命中直接返回 404，不访问上游
+		if *replayDir != "" {
+			ex.upstream, ex.url = "replay", "replay:"+r.URL.Path
+			rec, err := loadRecording(*replayDir, key)
+			if err != nil {
+				fmt.Printf("=== Replay #%d miss %s: %v ===\n", ex.id, key, err)
+				replayMiss(w, r, key)
+				ex.status, ex.duration = http.StatusNotFound, time.Since(ex.start)
+				stats.Observe(ex)
+				return
+			}
+			serveStored(rec, true)
+			if !*summaryOnly {
+				fmt.Printf("=== Replayed Response #%d %s ===\n", ex.id, key)
+				fmt.Println(string(ex.respHead))
+			}
+			finish(r, ex)
+			return
+		}
+
+		// ---- 缓存 ----
+		// 命中时立即返回缓存的响应，不保留原始时序
+		if cache != nil {
+			if !lookup {
+				w.Header().Set(cacheHeader, "BYPASS")
+			} else if rec := cache.Get(cacheKey(key, credential)); rec != nil {
+				ex.upstream = "cache"
+				w.Header().Set(cacheHeader, "HIT")
+				serveStored(rec, false)
+				if !*summaryOnly {
+					fmt.Printf("=== Cached Response #%d %s ===\n", ex.id, key)
+					fmt.Println(string(ex.respHead))
+				}
+				finish(r, ex)
+				return
+			} else {
+				w.Header().Set(cacheHeader, "MISS")
+			}
+		}
 
 		// ---- 构建新的转发请求 ----
-		// 用原始 method 和 body
-		outReq, err := http.NewRequest(r.Method, target.String()+r.URL.Path, r.Body)
+		// 用原始 method、body 和 query；客户端断开时 context 取消上游请求
+		outReq, err := http.NewRequestWithContext(r.Context(), r.Method, joinURL(base, upstreamPath, query), bytes.NewReader(ex.reqBody))
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
 
-		// 拷贝 headers
+		// 拷贝 headers(去掉 hop-by-hop)，并注入上游的认证 header
 		outReq.Header = r.Header.Clone()
+		removeHopHeaders(outReq.Header)
+		if upstream != nil {
+			if err := upstream.Apply(outReq); err != nil {
+				http.Error(w, err.Error(), 502)
+				return
+			}
+		}
+		if tr != nil {
+			// 响应需要解析后转换，由 Transport 负责解压
+			outReq.Header.Del("Accept-Encoding")
+			if rt.Translate == "anthropic" && outReq.Header.Get("anthropic-version") == "" {
+				outReq.Header.Set("anthropic-version", "2023-06-01")
+			}
+		}
 
 		// ---- 发往上游 ----
-		resp, err := http.DefaultClient.Do(outReq)
+		resp, err := client.Do(outReq)
 		if err != nil {
-			http.Error(w, err.Error(), 502)
+			if r.Context().Err() != nil {
+				fmt.Printf("=== #%d client went away before upstream responded (+%dms) ===\n", ex.id, time.Since(ex.start).Milliseconds())
+				return
+			}
+			status := http.StatusBadGateway
+			if errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) {
+				status = http.StatusGatewayTimeout
+			}
+			fmt.Printf("=== #%d upstream error: %v ===\n", ex.id, err)
+			http.Error(w, err.Error(), status)
+			ex.status, ex.duration = status, time.Since(ex.start)
+			stats.Observe(ex)
 			return
 		}
 		defer resp.Body.Close()
 
-		// ---- 打印响应 ----
-		fmt.Println("=== Upstream Response ===")
-		respDump, _ := httputil.DumpResponse(resp, true)
-		fmt.Println(string(respDump))
-
-		if *dump {
-			data := append(reqDump, []byte("\n\n---\n\n")...)
-			data = append(data, respDump...)
-			dumpChan <- dumpJob{fmt.Sprintf("%s_%d_%d.txt", timestamp, reqID, resp.StatusCode), data}
+		// ---- 打印响应头 ----
+		// 只 dump header，body 边转发边打印，避免缓冲整个 SSE 流
+		ex.status = resp.StatusCode
+		ex.ttfb = time.Since(ex.start)
+		ex.stream = isEventStream(resp.Header)
+		ex.respHeader = resp.Header
+		ex.notify(nil)
+		ex.respHead = rd.DumpResponseHead(resp)
+		if !*summaryOnly {
+			fmt.Printf("=== Upstream Response #%d from %s (+%dms) ===\n", ex.id, ex.upstream, time.Since(ex.start).Milliseconds())
+			fmt.Println(string(ex.respHead))
 		}
 
 		// ---- 回传响应 ----
+		removeHopHeaders(resp.Header)
 		for k, v := range resp.Header {
 			for _, vv := range v {
 				w.Header().Add(k, vv)
 			}
 		}
+		var tw *translateWriter
+		if tr != nil {
+			tw = newTranslateWriter(w, tr)
+			w = tw
+		}
 		w.WriteHeader(resp.StatusCode)
-		io.Copy(w, resp.Body)
+		copyErr := copyResponse(w, resp, ex, rd, *summaryOnly)
+		if copyErr != nil {
+			err := copyErr
+			if r.Context().Err() != nil {
+				err = fmt.Errorf("client went away: %w", err)
+			}
+			fmt.Printf("=== Response #%d copy error: %v ===\n", ex.id, err)
+		}
+		if tw != nil {
+			tw.Close()
+		}
+		if fw != nil {
+			fw.Close()
+		}
+		ex.duration = time.Since(ex.start)
+		finish(r, ex)
+		limits.Record(clientKey, chargedTokens(ex))
+
+		// ---- 录制与缓存 ----
+		// 截断或中断的响应回放时会被当成完整响应，不录制也不缓存
+		complete := copyErr == nil && (fw == nil || !fw.dropped)
+		if *recordDir != "" && complete {
+			if err := saveRecording(*recordDir, newRecording(key, r, ex, rd)); err != nil {
+				fmt.Printf("=== Record #%d error: %v ===\n", ex.id, err)
+			}
+		}
+		// 只缓存完整的成功响应
+		if cache != nil && store && ex.status == http.StatusOK && complete {
+			cache.Put(cacheKey(key, credential), newRecording(key, r, ex, rd))
+		}
 	})
 
+	for _, rt := range config.Routes {
+		fmt.Printf("Route path_prefix=%q model=%q -> %s (%s)\n", rt.PathPrefix, rt.Model, rt.Upstream, config.Upstreams[rt.Upstream].BaseURL)
+	}
+	switch {
+	case *replayDir != "":
+		fmt.Printf("Replaying from %s, upstreams are not contacted\n", *replayDir)
+	case *recordDir != "":
+		fmt.Printf("Recording into %s\n", *recordDir)
+	}
+	if limits != nil {
+		by := "API key"
+		if config.Limits.header != "" {
+			by = config.Limits.header + " header"
+		}
+		fmt.Printf("Limiting clients by %s\n", by)
+	}
+	if cache != nil && *replayDir == "" {
+		fmt.Printf("Caching responses for %s, up to %d MiB\n", *cacheTTL, *cacheSize)
+	}
+	fmt.Printf("Default route -> %s\n", target)
 	fmt.Println("Forward proxy running on", *port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *port), handler))
+	// /metrics 和 /stats 由代理自己处理，其余全部转发
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", stats.ServeMetrics)
+	mux.HandleFunc("GET /stats", stats.ServeStats)
+	mux.Handle("/", handler)
+	if ins != nil {
+		mux.HandleFunc("GET /_inspect", ins.ServePage)
+		mux.HandleFunc("GET /_inspect/api/exchanges", ins.ServeList)
+		mux.HandleFunc("GET /_inspect/api/exchanges/{id}", ins.ServeExchange)
+		fmt.Printf("Inspector on http://localhost:%d/_inspect\n", *port)
+	}
+	fmt.Printf("Metrics on http://localhost:%d/metrics and /stats\n", *port)
+
+	// ---- 优雅退出 ----
+	// 收到 SIGINT/SIGTERM 后停止接收新连接，等待进行中的请求(包括流)结束，再写完 dump
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", *port),
+		Handler:           mux,
+		ReadHeaderTimeout: 30 * time.Second,
+		IdleTimeout:       5 * time.Minute,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		stop()
+		fmt.Printf("Shutting down, waiting up to %s for in-flight requests\n", *shutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+			srv.Close()
+		}
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-shutdownDone
+	if dumpChan != nil {
+		close(dumpChan)
+		<-dumpDone
+	}
 }
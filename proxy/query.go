@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runQuery implements `proxy query`: it filters JSONL dumps and prints one
+// line per exchange, the raw records, or a HAR file.
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	model := fs.String("model", "", "Model glob, e.g. 'gpt-4o*'")
+	status := fs.String("status", "", "Comma-separated statuses or classes, e.g. '200,5xx'")
+	pathPrefix := fs.String("path", "", "Path prefix")
+	upstream := fs.String("upstream", "", "Upstream name")
+	since := fs.String("since", "", "Start time (RFC3339, '2006-01-02 15:04:05' or a duration ago like 30m)")
+	until := fs.String("until", "", "End time, same formats as -since")
+	asJSON := fs.Bool("json", false, "Print matching records as JSONL")
+	asHAR := fs.Bool("har", false, "Print matching records as a HAR 1.2 document")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: proxy query [flags] [dump.jsonl ...]\n\nReads %s when no file is given.\n\n", defaultDumpFile)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var from, to time.Time
+	var err error
+	if from, err = parseTimeArg(*since); err != nil {
+		fmt.Fprintln(os.Stderr, "-since:", err)
+		return 2
+	}
+	if to, err = parseTimeArg(*until); err != nil {
+		fmt.Fprintln(os.Stderr, "-until:", err)
+		return 2
+	}
+	statusOK, err := statusFilter(*status)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "-status:", err)
+		return 2
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{defaultDumpFile}
+	}
+	var matched []*dumpRecord
+	for _, file := range files {
+		err := readDump(file, func(rec *dumpRecord, line []byte) {
+			if *model != "" {
+				if ok, _ := path.Match(*model, rec.model()); !ok {
+					return
+				}
+			}
+			if !statusOK(rec.Status) ||
+				(*pathPrefix != "" && !strings.HasPrefix(rec.Path, *pathPrefix)) ||
+				(*upstream != "" && rec.Upstream != *upstream) ||
+				(!from.IsZero() && rec.Time.Before(from)) ||
+				(!to.IsZero() && rec.Time.After(to)) {
+				return
+			}
+			switch {
+			case *asHAR:
+				matched = append(matched, rec)
+			case *asJSON:
+				fmt.Println(string(line))
+			default:
+				fmt.Println(rec.line())
+			}
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if *asHAR {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(toHAR(matched)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+func readDump(file string, fn func(rec *dumpRecord, line []byte)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var rec dumpRecord
+			if jerr := json.Unmarshal(line, &rec); jerr != nil {
+				return fmt.Errorf("%s:%d: %w", file, n, jerr)
+			}
+			fn(&rec, bytes.TrimRight(line, "\r\n"))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (rec *dumpRecord) model() string {
+	if rec.Summary != nil {
+		return rec.Summary.Model
+	}
+	return ""
+}
+
+// line renders the record in the proxy's summary line format.
+func (rec *dumpRecord) line() string {
+	s := fmt.Sprintf("%s #%d %s %s -> %s %d (%dms)", rec.Time.Format("2006-01-02 15:04:05"), rec.ID, rec.Method, rec.Path, rec.Upstream, rec.Status, rec.DurationMs)
+	if rec.Summary != nil {
+		s += "\n    " + rec.Summary.String()
+	}
+	return s
+}
+
+func parseTimeArg(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+}
+
+// statusFilter accepts exact codes and classes like 4xx.
+func statusFilter(s string) (func(int) bool, error) {
+	var codes []int
+	var classes []int
+	for _, v := range splitList(s) {
+		if len(v) == 3 && strings.HasSuffix(strings.ToLower(v), "xx") && v[0] >= '1' && v[0] <= '5' {
+			classes = append(classes, int(v[0]-'0'))
+			continue
+		}
+		code, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("bad status %q", v)
+		}
+		codes = append(codes, code)
+	}
+	return func(status int) bool {
+		if len(codes) == 0 && len(classes) == 0 {
+			return true
+		}
+		for _, c := range codes {
+			if status == c {
+				return true
+			}
+		}
+		for _, c := range classes {
+			if status/100 == c {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// ---- HAR 1.2 ----
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time              `json:"startedDateTime"`
+	Time            int64                  `json:"time"`
+	Request         map[string]interface{} `json:"request"`
+	Response        map[string]interface{} `json:"response"`
+	Cache           struct{}               `json:"cache"`
+	Timings         map[string]int64       `json:"timings"`
+}
+
+func toHAR(recs []*dumpRecord) map[string]interface{} {
+	entries := make([]harEntry, 0, len(recs))
+	for _, rec := range recs {
+		u, _ := url.Parse(rec.URL)
+		if u == nil {
+			u = &url.URL{Path: rec.Path}
+		}
+		u.RawQuery = rec.Query
+		var query []harNameValue
+		for name, vs := range u.Query() {
+			for _, v := range vs {
+				query = append(query, harNameValue{name, v})
+			}
+		}
+
+		reqText := bodyText(rec.Request)
+		request := map[string]interface{}{
+			"method":      rec.Method,
+			"url":         u.String(),
+			"httpVersion": "HTTP/1.1",
+			"headers":     harHeaders(rec.RequestHeader),
+			"queryString": append([]harNameValue{}, query...),
+			"cookies":     []interface{}{},
+			"headersSize": -1,
+			"bodySize":    len(reqText),
+		}
+		if reqText != "" {
+			request["postData"] = map[string]string{"mimeType": rec.RequestHeader.Get("Content-Type"), "text": reqText}
+		}
+
+		respText := bodyText(rec.Response)
+		if rec.Events != nil {
+			var b strings.Builder
+			for _, ev := range rec.Events {
+				if ev.Event != "" {
+					fmt.Fprintf(&b, "event: %s\n", ev.Event)
+				}
+				fmt.Fprintf(&b, "data: %s\n\n", bodyText(ev.Data))
+			}
+			respText = b.String()
+		}
+		response := map[string]interface{}{
+			"status":      rec.Status,
+			"statusText":  http.StatusText(rec.Status),
+			"httpVersion": "HTTP/1.1",
+			"headers":     harHeaders(rec.ResponseHeader),
+			"cookies":     []interface{}{},
+			"content":     map[string]interface{}{"size": len(respText), "mimeType": rec.ResponseHeader.Get("Content-Type"), "text": respText},
+			"redirectURL": "",
+			"headersSize": -1,
+			"bodySize":    len(respText),
+		}
+
+		entries = append(entries, harEntry{
+			StartedDateTime: rec.Time,
+			Time:            rec.DurationMs,
+			Request:         request,
+			Response:        response,
+			Timings:         map[string]int64{"send": 0, "wait": rec.TTFBMs, "receive": rec.DurationMs - rec.TTFBMs},
+		})
+	}
+	return map[string]interface{}{
+		"log": map[string]interface{}{
+			"version": "1.2",
+			"creator": map[string]string{"name": "llm-test proxy", "version": "1"},
+			"entries": entries,
+		},
+	}
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	out := []harNameValue{}
+	for name, vs := range h {
+		for _, v := range vs {
+			out = append(out, harNameValue{name, v})
+		}
+	}
+	return out
+}
+
+// bodyText turns a decoded record body back into text.
+func bodyText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultRedactHeaders = "Authorization,Proxy-Authorization,X-Api-Key,Api-Key,X-Goog-Api-Key,Cookie,Set-Cookie"
+	defaultRedactFields  = "api_key,apiKey,key,access_token,refresh_token,token,secret,password"
+	redacted             = "[REDACTED]"
+)
+
+// redactor masks credentials and bulky base64 payloads before anything is
+// printed or dumped. A nil redactor leaves data untouched.
+type redactor struct {
+	headers   map[string]bool // canonical header names
+	fields    map[string]bool // lower-cased JSON field and query parameter names
+	fieldRe   *regexp.Regexp
+	base64Re  *regexp.Regexp
+	dataURLRe *regexp.Regexp
+}
+
+// newRedactor builds a redactor from comma-separated header and field names.
+// Base64 strings of at least base64Min characters are replaced by their hash
+// and length; 0 disables that.
+func newRedactor(headers, fields string, base64Min int) *redactor {
+	rd := &redactor{
+		headers:   make(map[string]bool),
+		fields:    make(map[string]bool),
+		dataURLRe: regexp.MustCompile(`(data:[\w/.+-]+;base64,)([A-Za-z0-9+/=]+)`),
+	}
+	for _, h := range splitList(headers) {
+		rd.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	var quoted []string
+	for _, f := range splitList(fields) {
+		rd.fields[strings.ToLower(f)] = true
+		quoted = append(quoted, regexp.QuoteMeta(f))
+	}
+	if len(quoted) > 0 {
+		rd.fieldRe = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	}
+	if base64Min > 0 {
+		rd.base64Re = regexp.MustCompile(fmt.Sprintf(`"([A-Za-z0-9+/]{%d,}={0,2})"`, base64Min))
+	}
+	return rd
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Header returns a copy of h with sensitive values masked.
+func (rd *redactor) Header(h http.Header) http.Header {
+	out := h.Clone()
+	if rd == nil {
+		return out
+	}
+	for k, vs := range out {
+		if rd.headers[http.CanonicalHeaderKey(k)] {
+			for i := range vs {
+				vs[i] = maskSecret(vs[i])
+			}
+		}
+	}
+	return out
+}
+
+// maskSecret keeps the auth scheme and replaces long secrets by a short
+// hash, so different keys stay distinguishable in logs without revealing
+// any of their characters. Short values are too easy to guess from a hash.
+func maskSecret(v string) string {
+	scheme := ""
+	if i := strings.IndexByte(v, ' '); i > 0 {
+		scheme, v = v[:i+1], v[i+1:]
+	}
+	if len(v) > 12 {
+		sum := sha256.Sum256([]byte(v))
+		return scheme + "[REDACTED sha256:" + hex.EncodeToString(sum[:4]) + "]"
+	}
+	return scheme + redacted
+}
+
+// RawQuery masks query parameters named like sensitive fields, e.g. ?key=.
+func (rd *redactor) RawQuery(q string) string {
+	if rd == nil || q == "" {
+		return q
+	}
+	parts := strings.Split(q, "&")
+	for i, p := range parts {
+		name, _, ok := strings.Cut(p, "=")
+		if ok && rd.fields[strings.ToLower(name)] {
+			parts[i] = name + "=" + redacted
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Text masks sensitive JSON fields and base64 payloads in a body or SSE event
+// while keeping the original formatting.
+func (rd *redactor) Text(s string) string {
+	if rd == nil {
+		return s
+	}
+	if rd.fieldRe != nil {
+		s = rd.fieldRe.ReplaceAllString(s, `${1}"`+redacted+`"`)
+	}
+	s = rd.dataURLRe.ReplaceAllStringFunc(s, func(m string) string {
+		parts := rd.dataURLRe.FindStringSubmatch(m)
+		return parts[1] + digest(parts[2])
+	})
+	if rd.base64Re != nil {
+		s = rd.base64Re.ReplaceAllStringFunc(s, func(m string) string {
+			return `"` + digest(m[1:len(m)-1]) + `"`
+		})
+	}
+	return s
+}
+
+func digest(payload string) string {
+	sum := sha256.Sum256([]byte(payload))
+	return fmt.Sprintf("[base64 sha256:%s len=%d]", hex.EncodeToString(sum[:8]), len(payload))
+}
+
+// DumpRequest is httputil.DumpRequest with headers, query and body redacted.
+func (rd *redactor) DumpRequest(r *http.Request, body []byte) []byte {
+	clone := r.Clone(r.Context())
+	clone.Header = rd.Header(r.Header)
+	clone.URL.RawQuery = rd.RawQuery(r.URL.RawQuery)
+	clone.RequestURI = "" // dump the redacted URL instead of the original request line
+	clone.Body = io.NopCloser(bytes.NewReader([]byte(rd.Text(string(body)))))
+	dump, _ := httputil.DumpRequest(clone, true)
+	return dump
+}
+
+// DumpResponseHead is httputil.DumpResponse(resp, false) with headers redacted.
+func (rd *redactor) DumpResponseHead(resp *http.Response) []byte {
+	clone := *resp
+	clone.Header = rd.Header(resp.Header)
+	dump, _ := httputil.DumpResponse(&clone, false)
+	return dump
+}
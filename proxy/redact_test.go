@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "[REDACTED]"},
+		{"short", "[REDACTED]"},
+		{"Bearer short", "Bearer [REDACTED]"},
+		{"sk-abcdefghijklmnop", "[REDACTED sha256:32f4cf58]"},
+		{"Bearer sk-abcdefghijklmnop", "Bearer [REDACTED sha256:32f4cf58]"},
+		{"AIzaSyD-1234567890", "[REDACTED sha256:9a9e1f60]"},
+	}
+	for _, tt := range tests {
+		got := maskSecret(tt.in)
+		if got != tt.want {
+			t.Errorf("maskSecret(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if len(tt.in) > 4 && strings.Contains(got, tt.in[len(tt.in)-4:]) {
+			t.Errorf("maskSecret(%q) = %q reveals the end of the secret", tt.in, got)
+		}
+	}
+}
+
+func TestRedactorHeader(t *testing.T) {
+	rd := newRedactor(defaultRedactHeaders, defaultRedactFields, 256)
+	h := http.Header{
+		"Authorization":  {"Bearer sk-abcdefghijklmnop"},
+		"X-Goog-Api-Key": {"k"},
+		"Content-Type":   {"application/json"},
+	}
+	got := rd.Header(h)
+	if v := got.Get("Authorization"); v != "Bearer [REDACTED sha256:32f4cf58]" {
+		t.Errorf("Authorization = %q", v)
+	}
+	if v := got.Get("X-Goog-Api-Key"); v != "[REDACTED]" {
+		t.Errorf("X-Goog-Api-Key = %q", v)
+	}
+	if v := got.Get("Content-Type"); v != "application/json" {
+		t.Errorf("Content-Type = %q", v)
+	}
+	if h.Get("Authorization") != "Bearer sk-abcdefghijklmnop" {
+		t.Error("Header modified its input")
+	}
+}
+
+func TestRedactorRawQuery(t *testing.T) {
+	rd := newRedactor(defaultRedactHeaders, defaultRedactFields, 256)
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"alt=sse", "alt=sse"},
+		{"key=AIza123&alt=sse", "key=[REDACTED]&alt=sse"},
+		{"alt=sse&API_KEY=x&access_token=y", "alt=sse&API_KEY=[REDACTED]&access_token=[REDACTED]"},
+		{"keys=1", "keys=1"},
+	}
+	for _, tt := range tests {
+		if got := rd.RawQuery(tt.in); got != tt.want {
+			t.Errorf("RawQuery(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactorText(t *testing.T) {
+	rd := newRedactor(defaultRedactHeaders, defaultRedactFields, 256)
+	long := strings.Repeat("A", 300)
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", `{"model":"m","max_tokens":5}`, `{"model":"m","max_tokens":5}`},
+		{"field", `{"api_key": "sk-1", "Password":"p\"q"}`, `{"api_key": "[REDACTED]", "Password":"[REDACTED]"}`},
+		{"data URL", `{"url":"data:image/png;base64,aGVsbG8="}`, `{"url":"data:image/png;base64,[base64 sha256:333d6b3a3c1f5db6 len=8]"}`},
+		{"long base64", `{"data":"` + long + `"}`, `{"data":"[base64 sha256:4daeb9ac8be20328 len=300]"}`},
+		{"short base64", `{"data":"QUJD"}`, `{"data":"QUJD"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rd.Text(tt.in); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	var none *redactor
+	if got := none.Text(`{"api_key":"sk-1"}`); got != `{"api_key":"sk-1"}` {
+		t.Errorf("nil redactor changed text: %q", got)
+	}
+}
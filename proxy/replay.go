@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultVolatileFields are top-level JSON fields and query parameters left
+// out of the replay key because they change between otherwise identical runs.
+const defaultVolatileFields = "user,metadata,request_id"
+
+// recording is one exchange as stored by -record and served by -replay.
+type recording struct {
+	Key      string          `json:"key"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Request  string          `json:"request,omitempty"` // redacted, for reading only
+	Status   int             `json:"status"`
+	Header   http.Header     `json:"header"`
+	HeaderMs int64           `json:"header_ms"` // time until the response headers arrived
+	Body     string          `json:"body,omitempty"`
+	Events   []recordedEvent `json:"events,omitempty"`
+	Duration int64           `json:"duration_ms"`
+}
+
+type recordedEvent struct {
+	AtMs int64  `json:"at_ms"`
+	Raw  string `json:"raw"`
+}
+
+// requestKey hashes method, path, query and the canonicalized JSON body with
+// the ignored fields removed. Non-JSON bodies are hashed verbatim.
+func requestKey(r *http.Request, body []byte, ignore map[string]bool) string {
+	query := r.URL.Query()
+	for name := range query {
+		if ignore[strings.ToLower(name)] {
+			query.Del(name)
+		}
+	}
+
+	canonical := body
+	var v interface{}
+	if json.Unmarshal(body, &v) == nil {
+		if m, ok := v.(map[string]interface{}); ok {
+			for name := range m {
+				if ignore[strings.ToLower(name)] {
+					delete(m, name)
+				}
+			}
+		}
+		canonical, _ = json.Marshal(v) // map keys are sorted by encoding/json
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", r.Method, r.URL.Path, query.Encode())
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// ignoreSet lower-cases the comma-separated names for requestKey.
+func ignoreSet(lists ...string) map[string]bool {
+	set := make(map[string]bool)
+	for _, list := range lists {
+		for _, name := range splitList(list) {
+			set[strings.ToLower(name)] = true
+		}
+	}
+	return set
+}
+
+func recordingPath(dir, key string) string {
+	return filepath.Join(dir, key+".json")
+}
+
+// newRecording captures the finished exchange for -record and the cache.
+// Bodies are stored decompressed so the files stay readable.
+func newRecording(key string, r *http.Request, ex *exchange, rd *redactor) *recording {
+	rec := &recording{
+		Key:      key,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Request:  rd.Text(string(ex.reqBody)),
+		Status:   ex.status,
+		Header:   ex.respHeader.Clone(),
+		HeaderMs: ex.ttfb.Milliseconds(),
+		Duration: ex.duration.Milliseconds(),
+	}
+	rec.Header.Del("Content-Encoding")
+	rec.Header.Del("Content-Length")
+	if ex.stream {
+		for _, ev := range ex.events {
+			rec.Events = append(rec.Events, recordedEvent{AtMs: ev.At.Milliseconds(), Raw: ev.Raw})
+		}
+	} else {
+		rec.Body = string(decodedBody(ex.respHeader, ex.body.Bytes()))
+	}
+	return rec
+}
+
+func saveRecording(dir string, rec *recording) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(recordingPath(dir, rec.Key), data, 0644)
+}
+
+func loadRecording(dir, key string) (*recording, error) {
+	data, err := os.ReadFile(recordingPath(dir, key))
+	if err != nil {
+		return nil, err
+	}
+	var rec recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", recordingPath(dir, key), err)
+	}
+	return &rec, nil
+}
+
+// replay serves rec to the client and fills ex as if it had been proxied.
+// When timed, the header latency and the arrival offset of every SSE event
+// are reproduced.
+func replay(w http.ResponseWriter, rec *recording, ex *exchange, rd *redactor, quiet, timed bool) {
+	flusher, _ := w.(http.Flusher)
+	sleepUntil := func(ms int64) {
+		if timed {
+			time.Sleep(time.Until(ex.start.Add(time.Duration(ms) * time.Millisecond)))
+		}
+	}
+
+	sleepUntil(rec.HeaderMs)
+	ex.status = rec.Status
+	ex.respHeader = rec.Header
+	ex.stream = isEventStream(rec.Header)
+	ex.ttfb = time.Since(ex.start)
+	ex.notify(nil)
+	ex.respHead = rd.DumpResponseHead(&http.Response{
+		StatusCode: rec.Status,
+		Status:     fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     rec.Header,
+	})
+	for k, v := range rec.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Status)
+
+	if !ex.stream {
+		w.Write([]byte(rec.Body))
+		ex.body.WriteString(rec.Body)
+		return
+	}
+	for _, re := range rec.Events {
+		sleepUntil(re.AtMs)
+		if _, err := w.Write([]byte(re.Raw + "\n\n")); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		ev := parseSSEEvent(re.Raw, time.Since(ex.start))
+		ex.events = append(ex.events, ev)
+		ex.notify(&ev)
+		if !quiet {
+			fmt.Printf("[#%d +%dms] %s\n\n", ex.id, ev.At.Milliseconds(), rd.Text(re.Raw))
+		}
+	}
+}
+
+// replayMiss answers requests that have no recording, so missing fixtures
+// fail loudly instead of reaching the network.
+func replayMiss(w http.ResponseWriter, r *http.Request, key string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"type":    "replay_miss",
+			"message": fmt.Sprintf("no recording for %s %s (key %s)", r.Method, r.URL.Path, key),
+		},
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// RewriteRule edits matching requests before they are forwarded. Every
+// matching rule applies, in order.
+type RewriteRule struct {
+	RequestMatch `yaml:",inline"`
+
+	// Patch is a JSON merge patch (RFC 7386), as YAML or as a JSON string,
+	// applied like fastllmcurl's --patch.
+	Patch interface{} `yaml:"patch"`
+
+	// ModelMap renames exact models; models without an entry get
+	// StripModelPrefix removed and then AddModelPrefix added.
+	ModelMap         map[string]string `yaml:"model_map"`
+	StripModelPrefix string            `yaml:"strip_model_prefix"`
+	AddModelPrefix   string            `yaml:"add_model_prefix"`
+
+	SetHeaders    map[string]string `yaml:"set_headers"` // values are expanded with os.ExpandEnv
+	RemoveHeaders []string          `yaml:"remove_headers"`
+	SetQuery      map[string]string `yaml:"set_query"`
+	RemoveQuery   []string          `yaml:"remove_query"`
+
+	patch []byte
+}
+
+func (rw *RewriteRule) validate() error {
+	if err := rw.RequestMatch.validate(); err != nil {
+		return err
+	}
+	switch p := rw.Patch.(type) {
+	case nil:
+	case string:
+		rw.patch = []byte(p)
+	default:
+		b, err := json.Marshal(p)
+		if err != nil {
+			return fmt.Errorf("patch: %w", err)
+		}
+		rw.patch = b
+	}
+	if rw.patch != nil {
+		if _, err := jsonpatch.MergePatch([]byte(`{}`), rw.patch); err != nil {
+			return fmt.Errorf("patch: %w", err)
+		}
+	}
+	return nil
+}
+
+// MatchRewrites returns every rewrite rule matching the request.
+func (c *ProxyConfig) MatchRewrites(reqPath, model string) []*RewriteRule {
+	var out []*RewriteRule
+	for i := range c.Rewrites {
+		if rw := &c.Rewrites[i]; rw.Matches(reqPath, model) {
+			out = append(out, rw)
+		}
+	}
+	return out
+}
+
+// mapModel returns the model name rw forwards instead of model.
+func (rw *RewriteRule) mapModel(model string) string {
+	if m, ok := rw.ModelMap[model]; ok {
+		return m
+	}
+	if rw.StripModelPrefix == "" && rw.AddModelPrefix == "" {
+		return model
+	}
+	return rw.AddModelPrefix + strings.TrimPrefix(model, rw.StripModelPrefix)
+}
+
+// applyRewrites edits r in place and returns the new body. Bodies that are
+// not JSON objects only get header and query edits. Models named in the path,
+// as Gemini does, are mapped in the path.
+func applyRewrites(r *http.Request, body []byte, rules []*RewriteRule) ([]byte, error) {
+	var obj map[string]interface{}
+	isJSON := json.Unmarshal(body, &obj) == nil && obj != nil
+
+	for _, rw := range rules {
+		if isJSON && rw.patch != nil {
+			patched, err := jsonpatch.MergePatch(body, rw.patch)
+			if err != nil {
+				return nil, fmt.Errorf("patch: %w", err)
+			}
+			body = patched
+			obj = nil
+			json.Unmarshal(body, &obj)
+		}
+
+		if model := requestModel(r.URL.Path, obj); model != "" {
+			if mapped := rw.mapModel(model); mapped != model {
+				if _, inBody := obj["model"]; inBody {
+					obj["model"] = mapped
+					b, err := json.Marshal(obj)
+					if err != nil {
+						return nil, err
+					}
+					body = b
+				} else {
+					r.URL.Path = strings.Replace(r.URL.Path, "/models/"+model+":", "/models/"+mapped+":", 1)
+					r.URL.RawPath = ""
+				}
+			}
+		}
+
+		for _, name := range rw.RemoveHeaders {
+			r.Header.Del(name)
+		}
+		for name, v := range rw.SetHeaders {
+			r.Header.Set(name, os.ExpandEnv(v))
+		}
+
+		if len(rw.SetQuery) > 0 || len(rw.RemoveQuery) > 0 {
+			q := r.URL.Query()
+			for _, name := range rw.RemoveQuery {
+				q.Del(name)
+			}
+			for name, v := range rw.SetQuery {
+				q.Set(name, os.ExpandEnv(v))
+			}
+			r.URL.RawQuery = q.Encode()
+		}
+	}
+	return body, nil
+}
+
+// describeRewrites lists what changed, for the log line.
+func describeRewrites(rd *redactor, rules []*RewriteRule, before *url.URL, r *http.Request, fromModel, toModel string, bodyChanged bool) string {
+	var parts []string
+	if fromModel != toModel {
+		parts = append(parts, fmt.Sprintf("model %s -> %s", fromModel, toModel))
+	}
+	if before.Path != r.URL.Path {
+		parts = append(parts, "path "+r.URL.Path)
+	}
+	if before.RawQuery != r.URL.RawQuery {
+		parts = append(parts, "query "+rd.RawQuery(r.URL.RawQuery))
+	}
+	if bodyChanged {
+		parts = append(parts, "body patched")
+	}
+	for _, rw := range rules {
+		if len(rw.SetHeaders) > 0 || len(rw.RemoveHeaders) > 0 {
+			parts = append(parts, "headers applied")
+			break
+		}
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestApplyRewrites(t *testing.T) {
+	t.Setenv("REWRITE_TEST_KEY", "secret")
+	tests := []struct {
+		name      string
+		target    string
+		body      string
+		headers   map[string]string
+		rules     []RewriteRule
+		wantURL   string
+		wantBody  string // compared as JSON unless it does not parse
+		wantHeads map[string]string
+	}{
+		{
+			name:     "merge patch",
+			target:   "/v1/chat/completions",
+			body:     `{"model":"m","temperature":1,"stop":["x"]}`,
+			rules:    []RewriteRule{{Patch: map[string]interface{}{"temperature": 0, "stop": nil, "seed": 7}}},
+			wantURL:  "/v1/chat/completions",
+			wantBody: `{"model":"m","temperature":0,"seed":7}`,
+		},
+		{
+			name:     "patch as JSON string",
+			target:   "/v1/chat/completions",
+			body:     `{"model":"m"}`,
+			rules:    []RewriteRule{{Patch: `{"max_tokens":10}`}},
+			wantURL:  "/v1/chat/completions",
+			wantBody: `{"model":"m","max_tokens":10}`,
+		},
+		{
+			name:     "model map wins over prefixes",
+			target:   "/v1/chat/completions",
+			body:     `{"model":"gpt-4o"}`,
+			rules:    []RewriteRule{{ModelMap: map[string]string{"gpt-4o": "openai/gpt-4o-2024"}, AddModelPrefix: "x/"}},
+			wantURL:  "/v1/chat/completions",
+			wantBody: `{"model":"openai/gpt-4o-2024"}`,
+		},
+		{
+			name:     "strip and add prefix",
+			target:   "/v1/messages",
+			body:     `{"model":"anthropic/claude-x","max_tokens":5}`,
+			rules:    []RewriteRule{{StripModelPrefix: "anthropic/", AddModelPrefix: "us."}},
+			wantURL:  "/v1/messages",
+			wantBody: `{"model":"us.claude-x","max_tokens":5}`,
+		},
+		{
+			name:     "gemini model in the path",
+			target:   "/v1beta/models/gemini-pro:streamGenerateContent?alt=sse",
+			body:     `{"contents":[]}`,
+			rules:    []RewriteRule{{ModelMap: map[string]string{"gemini-pro": "gemini-2.5-pro"}}},
+			wantURL:  "/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse",
+			wantBody: `{"contents":[]}`,
+		},
+		{
+			name:      "headers and query",
+			target:    "/v1/chat/completions?debug=1&key=old",
+			body:      `{"model":"m"}`,
+			headers:   map[string]string{"X-Drop": "1", "Authorization": "Bearer client"},
+			rules:     []RewriteRule{{RemoveHeaders: []string{"X-Drop"}, SetHeaders: map[string]string{"Authorization": "Bearer $REWRITE_TEST_KEY"}, RemoveQuery: []string{"debug"}, SetQuery: map[string]string{"key": "${REWRITE_TEST_KEY}"}}},
+			wantURL:   "/v1/chat/completions?key=secret",
+			wantBody:  `{"model":"m"}`,
+			wantHeads: map[string]string{"X-Drop": "", "Authorization": "Bearer secret"},
+		},
+		{
+			name:     "rules apply in order",
+			target:   "/v1/chat/completions",
+			body:     `{"model":"a"}`,
+			rules:    []RewriteRule{{ModelMap: map[string]string{"a": "b"}}, {ModelMap: map[string]string{"b": "c"}}, {Patch: `{"n":2}`}},
+			wantURL:  "/v1/chat/completions",
+			wantBody: `{"model":"c","n":2}`,
+		},
+		{
+			name:     "non-JSON body is left alone",
+			target:   "/v1/audio?x=1",
+			body:     "raw bytes",
+			rules:    []RewriteRule{{Patch: `{"a":1}`, SetQuery: map[string]string{"x": "2"}}},
+			wantURL:  "/v1/audio?x=2",
+			wantBody: "raw bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.target, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			var rules []*RewriteRule
+			for i := range tt.rules {
+				if err := tt.rules[i].validate(); err != nil {
+					t.Fatalf("rule %d: %v", i, err)
+				}
+				rules = append(rules, &tt.rules[i])
+			}
+
+			body, err := applyRewrites(r, []byte(tt.body), rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.URL.RequestURI(); got != tt.wantURL {
+				t.Errorf("URL = %q, want %q", got, tt.wantURL)
+			}
+			var got, want interface{}
+			if json.Unmarshal([]byte(tt.wantBody), &want) != nil {
+				if string(body) != tt.wantBody {
+					t.Errorf("body = %q, want %q", body, tt.wantBody)
+				}
+			} else if json.Unmarshal(body, &got); !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+			for k, v := range tt.wantHeads {
+				if got := r.Header.Get(k); got != v {
+					t.Errorf("header %s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteRuleValidate(t *testing.T) {
+	if err := (&RewriteRule{Patch: `{"a":`}).validate(); err == nil {
+		t.Error("broken patch string accepted")
+	}
+	if err := (&RewriteRule{RequestMatch: RequestMatch{Model: "["}}).validate(); err == nil {
+		t.Error("broken model glob accepted")
+	}
+}
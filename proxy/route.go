@@ -0,0 +1,372 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tokenTTL is how long a resolved upstream token is reused before the
+// token_cmd or token file is consulted again.
+const tokenTTL = 5 * time.Minute
+
+// Upstream uses the provider schema of fastllmcurl's providers.yaml, so the
+// same file can describe where the proxy forwards to.
+type Upstream struct {
+	BaseURL      string            `yaml:"base_url"`
+	Path         map[string]string `yaml:"path"` // chat, message, gemini, gemini_stream, response; {model} is substituted
+	FusionHeader bool              `yaml:"fusion_header"`
+	TokenCmd     string            `yaml:"token_cmd"`
+	AuthHeader   *bool             `yaml:"auth_header"`
+	Headers      map[string]string `yaml:"headers"`
+
+	name    string
+	mu      sync.Mutex
+	token   string
+	tokenAt time.Time
+}
+
+// RequestMatch selects requests by path prefix and by a path.Match glob
+// against the request model. Empty fields match anything.
+type RequestMatch struct {
+	PathPrefix string `yaml:"path_prefix"`
+	Model      string `yaml:"model"`
+}
+
+func (m *RequestMatch) Matches(reqPath, model string) bool {
+	if m.PathPrefix != "" && !strings.HasPrefix(reqPath, m.PathPrefix) {
+		return false
+	}
+	if m.Model != "" {
+		if ok, _ := path.Match(m.Model, model); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *RequestMatch) validate() error {
+	if _, err := path.Match(m.Model, ""); err != nil {
+		return fmt.Errorf("bad model pattern %q: %w", m.Model, err)
+	}
+	return nil
+}
+
+// Route sends matching requests to Upstream. With Translate set to
+// "anthropic" or "gemini", OpenAI chat completions requests are converted to
+// that protocol and the responses converted back.
+type Route struct {
+	RequestMatch `yaml:",inline"`
+	StripPrefix  bool   `yaml:"strip_prefix"`
+	Upstream     string `yaml:"upstream"`
+	Translate    string `yaml:"translate"`
+}
+
+// ProxyConfig is the file passed with -config.
+type ProxyConfig struct {
+	Upstreams map[string]*Upstream `yaml:"upstreams"`
+	Routes    []Route              `yaml:"routes"`
+	Faults    []FaultRule          `yaml:"faults"`
+	Rewrites  []RewriteRule        `yaml:"rewrites"`
+	Limits    LimitConfig          `yaml:"limits"`
+}
+
+// gatewayPaths are the protocol paths of the novita and ppio gateways.
+var gatewayPaths = map[string]string{
+	"chat":          "openai/v1/chat/completions",
+	"message":       "anthropic/v1/messages",
+	"gemini":        "gemini/v1/models/{model}:generateContent",
+	"gemini_stream": "gemini/v1/models/{model}:streamGenerateContent",
+	"response":      "openai/v1/responses",
+}
+
+// defaultPaths are used for protocols an upstream has no path for, and match
+// the native Anthropic and Gemini APIs.
+var defaultPaths = map[string]string{
+	"chat":          "v1/chat/completions",
+	"message":       "v1/messages",
+	"gemini":        "v1beta/models/{model}:generateContent",
+	"gemini_stream": "v1beta/models/{model}:streamGenerateContent",
+	"response":      "v1/responses",
+}
+
+// builtinUpstreams mirrors the builtin providers of fastllmcurl.
+var builtinUpstreams = map[string]*Upstream{
+	"novita":     {BaseURL: "https://api.novita.ai", Path: gatewayPaths, FusionHeader: true},
+	"novita-dev": {BaseURL: "https://dev-api.novita.ai", Path: gatewayPaths, FusionHeader: true},
+	"ppio":       {BaseURL: "https://api.ppio.com", Path: gatewayPaths, FusionHeader: true},
+	"ppio-dev":   {BaseURL: "https://dev-api.ppinfra.com", Path: gatewayPaths, FusionHeader: true},
+	"local-fusion": {
+		BaseURL: "http://localhost:8000/fusion/v1",
+		Path: map[string]string{
+			"chat":          "{model}/v1/chat/completions",
+			"message":       "{model}/v1/messages",
+			"gemini":        "{model}:generateContent",
+			"gemini_stream": "{model}:streamGenerateContent",
+			"response":      "{model}/v1/responses",
+		},
+		AuthHeader: boolPtr(false),
+	},
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// LoadProxyConfig reads the builtin upstreams, then providersPath (skipped
+// when missing), then configPath when set. Later definitions win.
+func LoadProxyConfig(configPath, providersPath string) (*ProxyConfig, error) {
+	cfg := &ProxyConfig{Upstreams: make(map[string]*Upstream)}
+	for name, u := range builtinUpstreams {
+		cfg.Upstreams[name] = &Upstream{BaseURL: u.BaseURL, Path: mergeStrings(nil, u.Path), FusionHeader: u.FusionHeader, AuthHeader: u.AuthHeader}
+	}
+
+	if providersPath != "" {
+		data, err := os.ReadFile(providersPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", providersPath, err)
+		}
+		if err == nil {
+			var providers map[string]*Upstream
+			if err := yaml.Unmarshal(data, &providers); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", providersPath, err)
+			}
+			mergeUpstreams(cfg.Upstreams, providers)
+		}
+	}
+
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", configPath, err)
+		}
+		var file ProxyConfig
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", configPath, err)
+		}
+		mergeUpstreams(cfg.Upstreams, file.Upstreams)
+		cfg.Routes = file.Routes
+		cfg.Faults = file.Faults
+		cfg.Rewrites = file.Rewrites
+		cfg.Limits = file.Limits
+	}
+
+	for name, u := range cfg.Upstreams {
+		u.name = name
+	}
+	for i, rt := range cfg.Routes {
+		if rt.Upstream == "" {
+			return nil, fmt.Errorf("routes[%d]: upstream is required", i)
+		}
+		u, ok := cfg.Upstreams[rt.Upstream]
+		if !ok {
+			return nil, fmt.Errorf("routes[%d]: unknown upstream %q", i, rt.Upstream)
+		}
+		if _, err := parseBaseURL(u.BaseURL); err != nil {
+			return nil, fmt.Errorf("routes[%d]: upstream %q: base_url: %w", i, rt.Upstream, err)
+		}
+		if err := rt.validate(); err != nil {
+			return nil, fmt.Errorf("routes[%d]: %w", i, err)
+		}
+		if rt.Translate != "" && newTranslator(rt.Translate) == nil {
+			return nil, fmt.Errorf("routes[%d]: unknown translate target %q, want anthropic or gemini", i, rt.Translate)
+		}
+	}
+	for i := range cfg.Rewrites {
+		if err := cfg.Rewrites[i].validate(); err != nil {
+			return nil, fmt.Errorf("rewrites[%d]: %w", i, err)
+		}
+	}
+	for i := range cfg.Faults {
+		if err := cfg.Faults[i].validate(); err != nil {
+			return nil, fmt.Errorf("faults[%d]: %w", i, err)
+		}
+	}
+	if err := cfg.Limits.validate(); err != nil {
+		return nil, fmt.Errorf("limits: %w", err)
+	}
+	return cfg, nil
+}
+
+// mergeUpstreams overlays src onto dst field by field, like fastllmcurl's
+// mergeProvider. Path and headers are merged key by key.
+func mergeUpstreams(dst, src map[string]*Upstream) {
+	for name, u := range src {
+		if u == nil {
+			continue
+		}
+		existing, ok := dst[name]
+		if !ok {
+			dst[name] = u
+			continue
+		}
+		if u.BaseURL != "" {
+			existing.BaseURL = u.BaseURL
+		}
+		if len(u.Path) > 0 {
+			existing.Path = mergeStrings(existing.Path, u.Path)
+		}
+		if u.TokenCmd != "" {
+			existing.TokenCmd = u.TokenCmd
+		}
+		if u.AuthHeader != nil {
+			existing.AuthHeader = u.AuthHeader
+		}
+		if len(u.Headers) > 0 {
+			existing.Headers = mergeStrings(existing.Headers, u.Headers)
+		}
+		existing.FusionHeader = u.FusionHeader
+	}
+}
+
+// mergeStrings returns a new map with the entries of dst overridden by src,
+// leaving both untouched.
+func mergeStrings(dst, src map[string]string) map[string]string {
+	merged := make(map[string]string, len(dst)+len(src))
+	for k, v := range dst {
+		merged[k] = v
+	}
+	for k, v := range src {
+		merged[k] = v
+	}
+	return merged
+}
+
+func defaultProvidersPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".llm-test", "providers.yaml")
+}
+
+// Match returns the first route matching the request, or nil.
+func (c *ProxyConfig) Match(reqPath, model string) *Route {
+	for i := range c.Routes {
+		if rt := &c.Routes[i]; rt.Matches(reqPath, model) {
+			return rt
+		}
+	}
+	return nil
+}
+
+// UpstreamPath is the request path as forwarded by rt.
+func (rt *Route) UpstreamPath(reqPath string) string {
+	if rt.StripPrefix {
+		reqPath = "/" + strings.TrimLeft(strings.TrimPrefix(reqPath, rt.PathPrefix), "/")
+	}
+	return reqPath
+}
+
+// ProtocolPath returns the path of reqType (a fastllmcurl request type) for
+// model, split from any query it carries.
+func (u *Upstream) ProtocolPath(reqType, model string) (string, string) {
+	p, ok := u.Path[reqType]
+	if !ok {
+		p = defaultPaths[reqType]
+	}
+	p = strings.ReplaceAll(p, "{model}", model)
+	p, query, _ := strings.Cut(p, "?")
+	return "/" + strings.TrimPrefix(p, "/"), query
+}
+
+// Apply injects the upstream's auth and extra headers into req. When the
+// upstream has its own auth, every credential of the client is removed, so
+// no key meant for one vendor reaches another.
+func (u *Upstream) Apply(req *http.Request) error {
+	h := req.Header
+	if u.NeedsAuth() {
+		token, err := u.Token()
+		if err != nil {
+			return err
+		}
+		h.Set("Authorization", "Bearer "+token)
+		for _, name := range apiKeyHeaders {
+			h.Del(name)
+		}
+		if q := req.URL.Query(); q.Has("key") {
+			q.Del("key")
+			req.URL.RawQuery = q.Encode()
+		}
+	}
+	if u.FusionHeader {
+		h.Set("X-Fusion-Beta", "with-provider-detail-2026-07-11")
+	}
+	for k, v := range u.Headers {
+		h.Set(k, os.ExpandEnv(v))
+	}
+	return nil
+}
+
+func (u *Upstream) NeedsAuth() bool {
+	if u.AuthHeader == nil {
+		return true
+	}
+	return *u.AuthHeader
+}
+
+// Token resolves the upstream API key the same way fastllmcurl does:
+// token_cmd, then ~/.llm-test/<name>, ~/.llm-test/<name>.jwt and
+// finally the <NAME>_API_KEY environment variable.
+func (u *Upstream) Token() (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.token != "" && time.Since(u.tokenAt) < tokenTTL {
+		return u.token, nil
+	}
+
+	token, err := u.lookupToken()
+	if err != nil {
+		return "", err
+	}
+	u.token, u.tokenAt = token, time.Now()
+	return token, nil
+}
+
+func (u *Upstream) lookupToken() (string, error) {
+	if u.TokenCmd != "" {
+		output, err := exec.Command("sh", "-c", u.TokenCmd).Output()
+		if err != nil {
+			return "", fmt.Errorf("token_cmd %q failed: %w", u.TokenCmd, err)
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	var tried []string
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, file := range []string{u.name, u.name + ".jwt"} {
+			p := filepath.Join(home, ".llm-test", file)
+			if data, err := os.ReadFile(p); err == nil {
+				return strings.TrimSpace(string(data)), nil
+			}
+			tried = append(tried, p)
+		}
+	}
+
+	envKey := strings.ToUpper(strings.ReplaceAll(u.name, "-", "_")) + "_API_KEY"
+	if token := os.Getenv(envKey); token != "" {
+		return token, nil
+	}
+	tried = append(tried, "env:"+envKey)
+	return "", fmt.Errorf("no token found for upstream %q, tried: %v", u.name, tried)
+}
+
+// requestModel returns the model a request asks for, from the JSON body or
+// the Gemini-style path.
+func requestModel(reqPath string, body map[string]interface{}) string {
+	if m := str(body["model"]); m != "" {
+		return m
+	}
+	if strings.Contains(reqPath, ":generateContent") || strings.Contains(reqPath, ":streamGenerateContent") {
+		return geminiModel(reqPath)
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sseEvent is one server-sent event as it arrived from the upstream.
+type sseEvent struct {
+	At   time.Duration // offset from the start of the exchange
+	Name string        // the "event:" field, empty for unnamed events
+	Data string        // "data:" lines joined by newlines
+	Raw  string
+}
+
+// sseParser splits a byte stream into server-sent events. Bytes are fed in
+// with Write as they arrive and onEvent is called for every complete event.
+type sseParser struct {
+	buf     []byte
+	onEvent func(raw string)
+}
+
+func (p *sseParser) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		end, sepLen := eventBoundary(p.buf)
+		if end < 0 {
+			return len(b), nil
+		}
+		raw := string(p.buf[:end])
+		p.buf = p.buf[end+sepLen:]
+		if strings.TrimSpace(raw) != "" {
+			p.onEvent(raw)
+		}
+	}
+}
+
+// Flush emits whatever is left when the stream ends without a blank line.
+func (p *sseParser) Flush() {
+	if raw := string(p.buf); strings.TrimSpace(raw) != "" {
+		p.onEvent(raw)
+	}
+	p.buf = nil
+}
+
+// eventBoundary returns the index of the first blank line separating two
+// events and the length of the separator, or -1.
+func eventBoundary(b []byte) (int, int) {
+	best, bestLen := -1, 0
+	for _, sep := range []string{"\n\n", "\r\n\r\n"} {
+		if i := bytes.Index(b, []byte(sep)); i >= 0 && (best < 0 || i < best) {
+			best, bestLen = i, len(sep)
+		}
+	}
+	return best, bestLen
+}
+
+func parseSSEEvent(raw string, at time.Duration) sseEvent {
+	ev := sseEvent{At: at, Raw: raw}
+	var data []string
+	for _, line := range strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			ev.Name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	ev.Data = strings.Join(data, "\n")
+	return ev
+}
+
+func isEventStream(h http.Header) bool {
+	return strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
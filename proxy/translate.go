@@ -0,0 +1,805 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// chatTranslator converts one OpenAI chat completions exchange to another
+// protocol and the responses back. A translator is used for one request only
+// because streamed responses need state.
+type chatTranslator interface {
+	// Request converts the chat completions request body and returns the
+	// fastllmcurl request type whose upstream path it must be sent to.
+	Request(req map[string]interface{}) (body map[string]interface{}, reqType string, err error)
+	// Response converts a non-streamed response body.
+	Response(body []byte) (map[string]interface{}, error)
+	// Event converts one upstream SSE event into zero or more chunks.
+	Event(ev sseEvent) []map[string]interface{}
+	// Done returns the chunks that end the stream, before [DONE].
+	Done() []map[string]interface{}
+}
+
+func newTranslator(target string) chatTranslator {
+	base := chatState{created: time.Now().Unix(), toolIndex: make(map[int]int)}
+	switch target {
+	case "anthropic":
+		return &anthropicTranslator{chatState: base}
+	case "gemini":
+		return &geminiTranslator{chatState: base}
+	}
+	return nil
+}
+
+// chatState is what both translators need to emit OpenAI responses.
+type chatState struct {
+	id           string
+	model        string
+	created      int64
+	includeUsage bool
+	usage        map[string]interface{}
+	toolIndex    map[int]int // upstream content block index -> tool_calls index
+	toolCalls    int
+	started      bool // the first chunk, carrying the role, was sent
+}
+
+func (c *chatState) readRequest(req map[string]interface{}) {
+	c.model = str(req["model"])
+	c.includeUsage, _ = asMap(req["stream_options"])["include_usage"].(bool)
+}
+
+func (c *chatState) chunk(delta map[string]interface{}, finish string) map[string]interface{} {
+	choice := map[string]interface{}{"index": 0, "delta": delta, "finish_reason": nil}
+	if finish != "" {
+		choice["finish_reason"] = finish
+	}
+	return map[string]interface{}{
+		"id":      c.id,
+		"object":  "chat.completion.chunk",
+		"created": c.created,
+		"model":   c.model,
+		"choices": []interface{}{choice},
+	}
+}
+
+// done emits the usage chunk requested with stream_options.include_usage.
+func (c *chatState) done() []map[string]interface{} {
+	if !c.includeUsage || c.usage == nil {
+		return nil
+	}
+	return []map[string]interface{}{{
+		"id":      c.id,
+		"object":  "chat.completion.chunk",
+		"created": c.created,
+		"model":   c.model,
+		"choices": []interface{}{},
+		"usage":   c.usage,
+	}}
+}
+
+func (c *chatState) completion(message map[string]interface{}, finish string) map[string]interface{} {
+	out := map[string]interface{}{
+		"id":      c.id,
+		"object":  "chat.completion",
+		"created": c.created,
+		"model":   c.model,
+		"choices": []interface{}{map[string]interface{}{"index": 0, "message": message, "finish_reason": finish}},
+	}
+	if c.usage != nil {
+		out["usage"] = c.usage
+	}
+	return out
+}
+
+func openAIUsage(prompt, completion, total int) map[string]interface{} {
+	if total == 0 {
+		total = prompt + completion
+	}
+	return map[string]interface{}{"prompt_tokens": prompt, "completion_tokens": completion, "total_tokens": total}
+}
+
+// translateError converts Anthropic ({"type":"error","error":{...}}) and
+// Gemini ({"error":{"code","message","status"}}) errors to the OpenAI shape.
+func translateError(status int, body []byte) []byte {
+	var e map[string]interface{}
+	json.Unmarshal(body, &e)
+	inner := asMap(e["error"])
+	msg := str(inner["message"])
+	typ := str(inner["type"])
+	if typ == "" {
+		typ = str(inner["status"])
+	}
+	if msg == "" {
+		msg = strings.TrimSpace(string(body))
+	}
+	if typ == "" {
+		typ = "upstream_error"
+	}
+	out, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{"message": msg, "type": typ, "code": status},
+	})
+	return out
+}
+
+// writeTranslateError rejects requests that cannot be translated.
+func writeTranslateError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": "translate: " + err.Error(),
+			"type":    "invalid_request_error",
+			"code":    http.StatusBadRequest,
+		},
+	})
+}
+
+// ---- 内容转换 ----
+
+// contentParts normalizes OpenAI message content to a list of parts.
+func contentParts(content interface{}) []map[string]interface{} {
+	switch c := content.(type) {
+	case string:
+		return []map[string]interface{}{{"type": "text", "text": c}}
+	case []interface{}:
+		var parts []map[string]interface{}
+		for _, p := range c {
+			if m := asMap(p); m != nil {
+				parts = append(parts, m)
+			}
+		}
+		return parts
+	}
+	return nil
+}
+
+// contentText joins the text parts of OpenAI message content.
+func contentText(content interface{}) string {
+	var texts []string
+	for _, p := range contentParts(content) {
+		if str(p["type"]) == "text" {
+			texts = append(texts, str(p["text"]))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// parseDataURL splits data:<mime>;base64,<data>.
+func parseDataURL(u string) (mime, data string, ok bool) {
+	rest, found := strings.CutPrefix(u, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found || !strings.HasSuffix(meta, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(meta, ";base64"), data, true
+}
+
+// toolArguments parses a tool call's JSON arguments string into an object.
+func toolArguments(args string) map[string]interface{} {
+	out := map[string]interface{}{}
+	if strings.TrimSpace(args) != "" {
+		json.Unmarshal([]byte(args), &out)
+	}
+	return out
+}
+
+func marshalString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// ---- OpenAI -> Anthropic messages ----
+
+type anthropicTranslator struct {
+	chatState
+	inputTokens int // message_delta usage leaves out the input tokens
+}
+
+var anthropicStopReasons = map[string]string{
+	"end_turn":      "stop",
+	"stop_sequence": "stop",
+	"max_tokens":    "length",
+	"tool_use":      "tool_calls",
+	"refusal":       "content_filter",
+}
+
+func (t *anthropicTranslator) Request(req map[string]interface{}) (map[string]interface{}, string, error) {
+	t.readRequest(req)
+	out := map[string]interface{}{"model": req["model"], "max_tokens": 4096}
+
+	var system []string
+	var messages []map[string]interface{}
+	appendBlocks := func(role string, blocks []interface{}) {
+		if n := len(messages); n > 0 && messages[n-1]["role"] == role {
+			messages[n-1]["content"] = append(messages[n-1]["content"].([]interface{}), blocks...)
+			return
+		}
+		messages = append(messages, map[string]interface{}{"role": role, "content": blocks})
+	}
+
+	for _, m := range asSlice(req["messages"]) {
+		msg := asMap(m)
+		switch role := str(msg["role"]); role {
+		case "system", "developer":
+			system = append(system, contentText(msg["content"]))
+		case "user", "assistant":
+			var blocks []interface{}
+			for _, p := range contentParts(msg["content"]) {
+				switch str(p["type"]) {
+				case "text":
+					if text := str(p["text"]); text != "" {
+						blocks = append(blocks, map[string]interface{}{"type": "text", "text": text})
+					}
+				case "image_url":
+					u := str(asMap(p["image_url"])["url"])
+					source := map[string]interface{}{"type": "url", "url": u}
+					if mime, data, ok := parseDataURL(u); ok {
+						source = map[string]interface{}{"type": "base64", "media_type": mime, "data": data}
+					}
+					blocks = append(blocks, map[string]interface{}{"type": "image", "source": source})
+				default:
+					return nil, "", fmt.Errorf("content part type %q is not supported for anthropic", str(p["type"]))
+				}
+			}
+			for _, tc := range asSlice(msg["tool_calls"]) {
+				fn := asMap(asMap(tc)["function"])
+				blocks = append(blocks, map[string]interface{}{
+					"type":  "tool_use",
+					"id":    asMap(tc)["id"],
+					"name":  fn["name"],
+					"input": toolArguments(str(fn["arguments"])),
+				})
+			}
+			appendBlocks(role, blocks)
+		case "tool":
+			appendBlocks("user", []interface{}{map[string]interface{}{
+				"type":        "tool_result",
+				"tool_use_id": msg["tool_call_id"],
+				"content":     contentText(msg["content"]),
+			}})
+		default:
+			return nil, "", fmt.Errorf("message role %q is not supported for anthropic", role)
+		}
+	}
+	out["messages"] = messages
+	if len(system) > 0 {
+		out["system"] = strings.Join(system, "\n\n")
+	}
+
+	for _, k := range []string{"max_completion_tokens", "max_tokens"} {
+		if v, ok := req[k]; ok && v != nil {
+			out["max_tokens"] = v
+			break
+		}
+	}
+	for _, k := range []string{"temperature", "top_p", "stream"} {
+		if v, ok := req[k]; ok && v != nil {
+			out[k] = v
+		}
+	}
+	switch stop := req["stop"].(type) {
+	case string:
+		out["stop_sequences"] = []string{stop}
+	case []interface{}:
+		out["stop_sequences"] = stop
+	}
+	if user := str(req["user"]); user != "" {
+		out["metadata"] = map[string]interface{}{"user_id": user}
+	}
+
+	var tools []interface{}
+	for _, tool := range asSlice(req["tools"]) {
+		fn := asMap(asMap(tool)["function"])
+		t := map[string]interface{}{"name": fn["name"], "input_schema": fn["parameters"]}
+		if fn["parameters"] == nil {
+			t["input_schema"] = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		if d := str(fn["description"]); d != "" {
+			t["description"] = d
+		}
+		tools = append(tools, t)
+	}
+	if len(tools) > 0 {
+		out["tools"] = tools
+	}
+	switch tc := req["tool_choice"].(type) {
+	case string:
+		typ, ok := map[string]string{"auto": "auto", "required": "any", "none": "none"}[tc]
+		if !ok {
+			return nil, "", fmt.Errorf("tool_choice %q is not supported for anthropic", tc)
+		}
+		out["tool_choice"] = map[string]interface{}{"type": typ}
+	case map[string]interface{}:
+		out["tool_choice"] = map[string]interface{}{"type": "tool", "name": asMap(tc["function"])["name"]}
+	}
+	return out, "message", nil
+}
+
+func (t *anthropicTranslator) usageFrom(u map[string]interface{}) {
+	if in := num(u["input_tokens"]) + num(u["cache_read_input_tokens"]) + num(u["cache_creation_input_tokens"]); in > 0 {
+		t.inputTokens = in
+	}
+	t.usage = openAIUsage(t.inputTokens, num(u["output_tokens"]), 0)
+}
+
+func (t *anthropicTranslator) Response(body []byte) (map[string]interface{}, error) {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	t.id = str(resp["id"])
+	if m := str(resp["model"]); m != "" {
+		t.model = m
+	}
+	t.usageFrom(asMap(resp["usage"]))
+
+	var text, thinking []string
+	var toolCalls []interface{}
+	for _, b := range asSlice(resp["content"]) {
+		block := asMap(b)
+		switch str(block["type"]) {
+		case "text":
+			text = append(text, str(block["text"]))
+		case "thinking":
+			thinking = append(thinking, str(block["thinking"]))
+		case "tool_use":
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":       block["id"],
+				"type":     "function",
+				"function": map[string]interface{}{"name": block["name"], "arguments": marshalString(block["input"])},
+			})
+		}
+	}
+	message := map[string]interface{}{"role": "assistant", "content": nil}
+	if len(text) > 0 {
+		message["content"] = strings.Join(text, "")
+	}
+	if len(thinking) > 0 {
+		message["reasoning_content"] = strings.Join(thinking, "")
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+	return t.completion(message, anthropicStopReasons[str(resp["stop_reason"])]), nil
+}
+
+func (t *anthropicTranslator) Event(ev sseEvent) []map[string]interface{} {
+	var data map[string]interface{}
+	if json.Unmarshal([]byte(ev.Data), &data) != nil {
+		return nil
+	}
+	switch str(data["type"]) {
+	case "message_start":
+		msg := asMap(data["message"])
+		t.id = str(msg["id"])
+		if m := str(msg["model"]); m != "" {
+			t.model = m
+		}
+		t.usageFrom(asMap(msg["usage"]))
+		t.started = true
+		return []map[string]interface{}{t.chunk(map[string]interface{}{"role": "assistant", "content": ""}, "")}
+	case "content_block_start":
+		block := asMap(data["content_block"])
+		if str(block["type"]) != "tool_use" {
+			return nil
+		}
+		i := t.toolCalls
+		t.toolIndex[num(data["index"])] = i
+		t.toolCalls++
+		return []map[string]interface{}{t.chunk(map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+			"index":    i,
+			"id":       block["id"],
+			"type":     "function",
+			"function": map[string]interface{}{"name": block["name"], "arguments": ""},
+		}}}, "")}
+	case "content_block_delta":
+		delta := asMap(data["delta"])
+		switch str(delta["type"]) {
+		case "text_delta":
+			return []map[string]interface{}{t.chunk(map[string]interface{}{"content": delta["text"]}, "")}
+		case "thinking_delta":
+			return []map[string]interface{}{t.chunk(map[string]interface{}{"reasoning_content": delta["thinking"]}, "")}
+		case "input_json_delta":
+			return []map[string]interface{}{t.chunk(map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+				"index":    t.toolIndex[num(data["index"])],
+				"function": map[string]interface{}{"arguments": delta["partial_json"]},
+			}}}, "")}
+		}
+	case "message_delta":
+		t.usageFrom(asMap(data["usage"]))
+		if reason := str(asMap(data["delta"])["stop_reason"]); reason != "" {
+			return []map[string]interface{}{t.chunk(map[string]interface{}{}, anthropicStopReasons[reason])}
+		}
+	case "error":
+		return []map[string]interface{}{{"error": data["error"]}}
+	}
+	return nil
+}
+
+func (t *anthropicTranslator) Done() []map[string]interface{} {
+	return t.done()
+}
+
+// ---- OpenAI -> Gemini generateContent ----
+
+type geminiTranslator struct {
+	chatState
+	stream bool
+}
+
+var geminiFinishReasons = map[string]string{
+	"STOP":       "stop",
+	"MAX_TOKENS": "length",
+	"SAFETY":     "content_filter",
+	"RECITATION": "content_filter",
+	"BLOCKLIST":  "content_filter",
+}
+
+// geminiSchema drops JSON Schema keywords Gemini rejects.
+func geminiSchema(v interface{}) interface{} {
+	switch s := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(s))
+		for k, val := range s {
+			if k == "additionalProperties" || k == "$schema" || k == "strict" {
+				continue
+			}
+			out[k] = geminiSchema(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(s))
+		for i, val := range s {
+			out[i] = geminiSchema(val)
+		}
+		return out
+	}
+	return v
+}
+
+func (t *geminiTranslator) Request(req map[string]interface{}) (map[string]interface{}, string, error) {
+	t.readRequest(req)
+	t.stream, _ = req["stream"].(bool)
+	t.id = fmt.Sprintf("chatcmpl-gemini-%d", time.Now().UnixNano())
+
+	var system []string
+	var contents []map[string]interface{}
+	toolNames := make(map[string]string) // tool_call_id -> function name
+	appendParts := func(role string, parts []interface{}) {
+		if n := len(contents); n > 0 && contents[n-1]["role"] == role {
+			contents[n-1]["parts"] = append(contents[n-1]["parts"].([]interface{}), parts...)
+			return
+		}
+		contents = append(contents, map[string]interface{}{"role": role, "parts": parts})
+	}
+
+	for _, m := range asSlice(req["messages"]) {
+		msg := asMap(m)
+		switch role := str(msg["role"]); role {
+		case "system", "developer":
+			system = append(system, contentText(msg["content"]))
+		case "user", "assistant":
+			var parts []interface{}
+			for _, p := range contentParts(msg["content"]) {
+				switch str(p["type"]) {
+				case "text":
+					if text := str(p["text"]); text != "" {
+						parts = append(parts, map[string]interface{}{"text": text})
+					}
+				case "image_url":
+					u := str(asMap(p["image_url"])["url"])
+					if mime, data, ok := parseDataURL(u); ok {
+						parts = append(parts, map[string]interface{}{"inlineData": map[string]interface{}{"mimeType": mime, "data": data}})
+					} else {
+						parts = append(parts, map[string]interface{}{"fileData": map[string]interface{}{"fileUri": u}})
+					}
+				default:
+					return nil, "", fmt.Errorf("content part type %q is not supported for gemini", str(p["type"]))
+				}
+			}
+			for _, tc := range asSlice(msg["tool_calls"]) {
+				fn := asMap(asMap(tc)["function"])
+				toolNames[str(asMap(tc)["id"])] = str(fn["name"])
+				parts = append(parts, map[string]interface{}{"functionCall": map[string]interface{}{
+					"name": fn["name"],
+					"args": toolArguments(str(fn["arguments"])),
+				}})
+			}
+			if role == "assistant" {
+				role = "model"
+			}
+			appendParts(role, parts)
+		case "tool":
+			text := contentText(msg["content"])
+			var response map[string]interface{}
+			if json.Unmarshal([]byte(text), &response) != nil || response == nil {
+				response = map[string]interface{}{"content": text}
+			}
+			appendParts("user", []interface{}{map[string]interface{}{"functionResponse": map[string]interface{}{
+				"name":     toolNames[str(msg["tool_call_id"])],
+				"response": response,
+			}}})
+		default:
+			return nil, "", fmt.Errorf("message role %q is not supported for gemini", role)
+		}
+	}
+
+	out := map[string]interface{}{"contents": contents}
+	if len(system) > 0 {
+		out["systemInstruction"] = map[string]interface{}{"parts": []interface{}{map[string]interface{}{"text": strings.Join(system, "\n\n")}}}
+	}
+
+	config := map[string]interface{}{}
+	for from, to := range map[string]string{
+		"temperature":           "temperature",
+		"top_p":                 "topP",
+		"max_tokens":            "maxOutputTokens",
+		"max_completion_tokens": "maxOutputTokens",
+		"seed":                  "seed",
+		"n":                     "candidateCount",
+		"presence_penalty":      "presencePenalty",
+		"frequency_penalty":     "frequencyPenalty",
+	} {
+		if v, ok := req[from]; ok && v != nil {
+			config[to] = v
+		}
+	}
+	switch stop := req["stop"].(type) {
+	case string:
+		config["stopSequences"] = []string{stop}
+	case []interface{}:
+		config["stopSequences"] = stop
+	}
+	if rf := asMap(req["response_format"]); rf != nil && str(rf["type"]) != "text" {
+		config["responseMimeType"] = "application/json"
+		if schema := asMap(rf["json_schema"])["schema"]; schema != nil {
+			config["responseSchema"] = geminiSchema(schema)
+		}
+	}
+	if len(config) > 0 {
+		out["generationConfig"] = config
+	}
+
+	var decls []interface{}
+	for _, tool := range asSlice(req["tools"]) {
+		fn := asMap(asMap(tool)["function"])
+		d := map[string]interface{}{"name": fn["name"]}
+		if desc := str(fn["description"]); desc != "" {
+			d["description"] = desc
+		}
+		if fn["parameters"] != nil {
+			d["parameters"] = geminiSchema(fn["parameters"])
+		}
+		decls = append(decls, d)
+	}
+	if len(decls) > 0 {
+		out["tools"] = []interface{}{map[string]interface{}{"functionDeclarations": decls}}
+	}
+	switch tc := req["tool_choice"].(type) {
+	case string:
+		mode, ok := map[string]string{"auto": "AUTO", "required": "ANY", "none": "NONE"}[tc]
+		if !ok {
+			return nil, "", fmt.Errorf("tool_choice %q is not supported for gemini", tc)
+		}
+		out["toolConfig"] = map[string]interface{}{"functionCallingConfig": map[string]interface{}{"mode": mode}}
+	case map[string]interface{}:
+		out["toolConfig"] = map[string]interface{}{"functionCallingConfig": map[string]interface{}{
+			"mode":                 "ANY",
+			"allowedFunctionNames": []interface{}{asMap(tc["function"])["name"]},
+		}}
+	}
+
+	if t.stream {
+		return out, "gemini_stream", nil
+	}
+	return out, "gemini", nil
+}
+
+func (t *geminiTranslator) usageFrom(u map[string]interface{}) {
+	if u != nil {
+		t.usage = openAIUsage(num(u["promptTokenCount"]), num(u["candidatesTokenCount"])+num(u["thoughtsTokenCount"]), num(u["totalTokenCount"]))
+	}
+}
+
+// candidate splits the first candidate into text, thoughts, tool calls and
+// the finish reason.
+func (t *geminiTranslator) candidate(resp map[string]interface{}) (text, thinking string, toolCalls []interface{}, finish string) {
+	if v := str(resp["modelVersion"]); v != "" {
+		t.model = v
+	}
+	t.usageFrom(asMap(resp["usageMetadata"]))
+	var cand map[string]interface{}
+	if cands := asSlice(resp["candidates"]); len(cands) > 0 {
+		cand = asMap(cands[0])
+	}
+	for _, p := range asSlice(asMap(cand["content"])["parts"]) {
+		part := asMap(p)
+		switch {
+		case part["functionCall"] != nil:
+			fc := asMap(part["functionCall"])
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"index":    t.toolCalls,
+				"id":       fmt.Sprintf("call_%d", t.toolCalls),
+				"type":     "function",
+				"function": map[string]interface{}{"name": fc["name"], "arguments": marshalString(fc["args"])},
+			})
+			t.toolCalls++
+		case part["thought"] == true:
+			thinking += str(part["text"])
+		default:
+			text += str(part["text"])
+		}
+	}
+	if reason := str(cand["finishReason"]); reason != "" {
+		finish = geminiFinishReasons[reason]
+		if finish == "" {
+			finish = "stop"
+		}
+		if t.toolCalls > 0 && finish == "stop" {
+			finish = "tool_calls"
+		}
+	}
+	return text, thinking, toolCalls, finish
+}
+
+func (t *geminiTranslator) Response(body []byte) (map[string]interface{}, error) {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	text, thinking, toolCalls, finish := t.candidate(resp)
+	message := map[string]interface{}{"role": "assistant", "content": nil}
+	if text != "" {
+		message["content"] = text
+	}
+	if thinking != "" {
+		message["reasoning_content"] = thinking
+	}
+	if len(toolCalls) > 0 {
+		for _, tc := range toolCalls {
+			delete(asMap(tc), "index")
+		}
+		message["tool_calls"] = toolCalls
+	}
+	return t.completion(message, finish), nil
+}
+
+func (t *geminiTranslator) Event(ev sseEvent) []map[string]interface{} {
+	var resp map[string]interface{}
+	if json.Unmarshal([]byte(ev.Data), &resp) != nil {
+		return nil
+	}
+	if resp["error"] != nil {
+		return []map[string]interface{}{{"error": resp["error"]}}
+	}
+	text, thinking, toolCalls, finish := t.candidate(resp)
+
+	delta := map[string]interface{}{}
+	if !t.started {
+		delta["role"] = "assistant"
+		t.started = true
+	}
+	if text != "" {
+		delta["content"] = text
+	}
+	if thinking != "" {
+		delta["reasoning_content"] = thinking
+	}
+	if len(toolCalls) > 0 {
+		delta["tool_calls"] = toolCalls
+	}
+	var chunks []map[string]interface{}
+	if len(delta) > 0 {
+		chunks = append(chunks, t.chunk(delta, ""))
+	}
+	if finish != "" {
+		chunks = append(chunks, t.chunk(map[string]interface{}{}, finish))
+	}
+	return chunks
+}
+
+func (t *geminiTranslator) Done() []map[string]interface{} {
+	return t.done()
+}
+
+// ---- 响应回写 ----
+
+// translateWriter converts upstream responses written through it back to
+// OpenAI chat completions. Streams are translated event by event; other
+// bodies are held until Close.
+type translateWriter struct {
+	http.ResponseWriter
+	tr     chatTranslator
+	status int
+	stream bool
+	parser *sseParser
+	held   bytes.Buffer
+	err    error
+}
+
+func newTranslateWriter(w http.ResponseWriter, tr chatTranslator) *translateWriter {
+	tw := &translateWriter{ResponseWriter: w, tr: tr}
+	tw.parser = &sseParser{onEvent: func(raw string) {
+		for _, c := range tr.Event(parseSSEEvent(raw, 0)) {
+			tw.writeChunk(c)
+		}
+	}}
+	return tw
+}
+
+func (tw *translateWriter) WriteHeader(status int) {
+	tw.status = status
+	tw.stream = status < 400 && isEventStream(tw.Header())
+	h := tw.Header()
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	if tw.stream {
+		h.Set("Content-Type", "text/event-stream")
+	} else {
+		h.Set("Content-Type", "application/json")
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *translateWriter) Write(b []byte) (int, error) {
+	if tw.stream {
+		tw.parser.Write(b)
+	} else {
+		tw.held.Write(b)
+	}
+	if tw.err != nil {
+		return 0, tw.err
+	}
+	return len(b), nil
+}
+
+func (tw *translateWriter) writeChunk(c map[string]interface{}) {
+	if tw.err != nil {
+		return
+	}
+	b, _ := json.Marshal(c)
+	if _, err := tw.ResponseWriter.Write([]byte("data: " + string(b) + "\n\n")); err != nil {
+		tw.err = err
+		return
+	}
+	tw.Flush()
+}
+
+func (tw *translateWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the stream with [DONE], or writes the translated body.
+func (tw *translateWriter) Close() {
+	if tw.stream {
+		tw.parser.Flush()
+		for _, c := range tw.tr.Done() {
+			tw.writeChunk(c)
+		}
+		if tw.err == nil {
+			tw.ResponseWriter.Write([]byte("data: [DONE]\n\n"))
+			tw.Flush()
+		}
+		return
+	}
+	if tw.status >= 400 {
+		tw.ResponseWriter.Write(translateError(tw.status, tw.held.Bytes()))
+		return
+	}
+	resp, err := tw.tr.Response(tw.held.Bytes())
+	if err != nil {
+		tw.ResponseWriter.Write(translateError(http.StatusBadGateway, []byte(err.Error())))
+		return
+	}
+	b, _ := json.Marshal(resp)
+	tw.ResponseWriter.Write(b)
+}
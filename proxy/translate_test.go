@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assertJSON compares got with the JSON want, ignoring key order and number
+// types.
+func assertJSON(t *testing.T, what string, got interface{}, want string) {
+	t.Helper()
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	var g, w interface{}
+	json.Unmarshal(b, &g)
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("%s: bad want: %v", what, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("%s =\n  %s\nwant\n  %s", what, b, want)
+	}
+}
+
+func parseJSON(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestAnthropicRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req  string
+		want string
+	}{
+		{
+			"system, stop and max tokens",
+			`{"model":"claude","messages":[{"role":"system","content":"be brief"},{"role":"developer","content":[{"type":"text","text":"no lists"}]},{"role":"user","content":"hi"}],
+			  "max_completion_tokens":100,"temperature":0.5,"stop":"END","user":"u1","stream":true}`,
+			`{"model":"claude","max_tokens":100,"temperature":0.5,"stream":true,"stop_sequences":["END"],"metadata":{"user_id":"u1"},
+			  "system":"be brief\n\nno lists","messages":[{"role":"user","content":[{"type":"text","text":"hi"}]}]}`,
+		},
+		{
+			"default max tokens and images",
+			`{"model":"claude","messages":[{"role":"user","content":[{"type":"text","text":"what is this"},
+			  {"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}},{"type":"image_url","image_url":{"url":"https://x/y.png"}}]}]}`,
+			`{"model":"claude","max_tokens":4096,"messages":[{"role":"user","content":[{"type":"text","text":"what is this"},
+			  {"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAAA"}},
+			  {"type":"image","source":{"type":"url","url":"https://x/y.png"}}]}]}`,
+		},
+		{
+			"tool round trip",
+			`{"model":"claude","messages":[{"role":"user","content":"weather?"},
+			  {"role":"assistant","content":null,"tool_calls":[{"id":"c1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+			  {"role":"tool","tool_call_id":"c1","content":"sunny"},{"role":"user","content":"thanks"}],
+			  "tools":[{"type":"function","function":{"name":"get_weather","description":"d","parameters":{"type":"object"}}},{"type":"function","function":{"name":"noop"}}],
+			  "tool_choice":"required"}`,
+			`{"model":"claude","max_tokens":4096,"messages":[
+			  {"role":"user","content":[{"type":"text","text":"weather?"}]},
+			  {"role":"assistant","content":[{"type":"tool_use","id":"c1","name":"get_weather","input":{"city":"Paris"}}]},
+			  {"role":"user","content":[{"type":"tool_result","tool_use_id":"c1","content":"sunny"},{"type":"text","text":"thanks"}]}],
+			  "tools":[{"name":"get_weather","description":"d","input_schema":{"type":"object"}},{"name":"noop","input_schema":{"type":"object","properties":{}}}],
+			  "tool_choice":{"type":"any"}}`,
+		},
+		{
+			"named tool choice",
+			`{"model":"claude","messages":[],"tool_choice":{"type":"function","function":{"name":"f"}}}`,
+			`{"model":"claude","max_tokens":4096,"messages":null,"tool_choice":{"type":"tool","name":"f"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, reqType, err := newTranslator("anthropic").Request(parseJSON(t, tt.req))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reqType != "message" {
+				t.Errorf("reqType = %q, want message", reqType)
+			}
+			assertJSON(t, "request", out, tt.want)
+		})
+	}
+}
+
+func TestTranslateRequestErrors(t *testing.T) {
+	tests := []struct {
+		target string
+		req    string
+		want   string
+	}{
+		{"anthropic", `{"messages":[{"role":"function","content":"x"}]}`, `message role "function"`},
+		{"anthropic", `{"messages":[{"role":"user","content":[{"type":"input_audio"}]}]}`, `content part type "input_audio"`},
+		{"anthropic", `{"messages":[],"tool_choice":"sometimes"}`, `tool_choice "sometimes"`},
+		{"gemini", `{"messages":[{"role":"function","content":"x"}]}`, `message role "function"`},
+		{"gemini", `{"messages":[],"tool_choice":"sometimes"}`, `tool_choice "sometimes"`},
+	}
+	for _, tt := range tests {
+		_, _, err := newTranslator(tt.target).Request(parseJSON(t, tt.req))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %s: err = %v, want %q", tt.target, tt.req, err, tt.want)
+		}
+	}
+}
+
+func TestAnthropicResponse(t *testing.T) {
+	tr := newTranslator("anthropic").(*anthropicTranslator)
+	tr.created = 1
+	tr.Request(parseJSON(t, `{"model":"claude","messages":[]}`))
+	got, err := tr.Response([]byte(`{"id":"msg_1","model":"claude-3","stop_reason":"tool_use",
+		"content":[{"type":"thinking","thinking":"hmm"},{"type":"text","text":"let me check"},{"type":"tool_use","id":"t1","name":"f","input":{"a":1}}],
+		"usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":7}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, "response", got, `{"id":"msg_1","object":"chat.completion","created":1,"model":"claude-3",
+		"choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":"let me check","reasoning_content":"hmm",
+		  "tool_calls":[{"id":"t1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]}}],
+		"usage":{"prompt_tokens":15,"completion_tokens":7,"total_tokens":22}}`)
+}
+
+func TestAnthropicEvents(t *testing.T) {
+	tr := newTranslator("anthropic").(*anthropicTranslator)
+	tr.created = 1
+	tr.Request(parseJSON(t, `{"model":"claude","messages":[],"stream":true,"stream_options":{"include_usage":true}}`))
+
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-3","usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"t1","name":"f"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"a\":"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`,
+		`{"type":"message_stop"}`,
+	}
+	var chunks []map[string]interface{}
+	for _, data := range events {
+		chunks = append(chunks, tr.Event(sseEvent{Data: data})...)
+	}
+	chunks = append(chunks, tr.Done()...)
+
+	head := `"id":"msg_1","object":"chat.completion.chunk","created":1,"model":"claude-3"`
+	assertJSON(t, "chunks", chunks, `[
+		{`+head+`,"choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]},
+		{`+head+`,"choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":null}]},
+		{`+head+`,"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"t1","type":"function","function":{"name":"f","arguments":""}}]},"finish_reason":null}]},
+		{`+head+`,"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"a\":"}}]},"finish_reason":null}]},
+		{`+head+`,"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]},
+		{`+head+`,"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":9,"total_tokens":19}}
+	]`)
+}
+
+func TestGeminiRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      string
+		wantType string
+		want     string
+	}{
+		{
+			"config and system",
+			`{"model":"gemini","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"}],
+			  "temperature":0.2,"max_tokens":50,"seed":3,"stop":["x","y"],
+			  "response_format":{"type":"json_schema","json_schema":{"schema":{"type":"object","additionalProperties":false,"properties":{"a":{"type":"string"}}}}}}`,
+			"gemini",
+			`{"contents":[{"role":"user","parts":[{"text":"hi"}]},{"role":"model","parts":[{"text":"hello"}]}],
+			  "systemInstruction":{"parts":[{"text":"be brief"}]},
+			  "generationConfig":{"temperature":0.2,"maxOutputTokens":50,"seed":3,"stopSequences":["x","y"],
+			    "responseMimeType":"application/json","responseSchema":{"type":"object","properties":{"a":{"type":"string"}}}}}`,
+		},
+		{
+			"tools and images",
+			`{"model":"gemini","stream":true,"messages":[
+			  {"role":"user","content":[{"type":"text","text":"look"},{"type":"image_url","image_url":{"url":"data:image/jpeg;base64,BBBB"}},{"type":"image_url","image_url":{"url":"gs://b/o.png"}}]},
+			  {"role":"assistant","tool_calls":[{"id":"c1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+			  {"role":"tool","tool_call_id":"c1","content":"{\"temp\":20}"},
+			  {"role":"tool","tool_call_id":"c1","content":"plain"}],
+			  "tools":[{"type":"function","function":{"name":"get_weather","parameters":{"$schema":"x","type":"object","strict":true}}}],
+			  "tool_choice":{"type":"function","function":{"name":"get_weather"}}}`,
+			"gemini_stream",
+			`{"contents":[
+			  {"role":"user","parts":[{"text":"look"},{"inlineData":{"mimeType":"image/jpeg","data":"BBBB"}},{"fileData":{"fileUri":"gs://b/o.png"}}]},
+			  {"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},
+			  {"role":"user","parts":[{"functionResponse":{"name":"get_weather","response":{"temp":20}}},{"functionResponse":{"name":"get_weather","response":{"content":"plain"}}}]}],
+			  "tools":[{"functionDeclarations":[{"name":"get_weather","parameters":{"type":"object"}}]}],
+			  "toolConfig":{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["get_weather"]}}}`,
+		},
+		{
+			"tool choice none",
+			`{"model":"gemini","messages":[{"role":"user","content":"hi"}],"tool_choice":"none"}`,
+			"gemini",
+			`{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"toolConfig":{"functionCallingConfig":{"mode":"NONE"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, reqType, err := newTranslator("gemini").Request(parseJSON(t, tt.req))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reqType != tt.wantType {
+				t.Errorf("reqType = %q, want %q", reqType, tt.wantType)
+			}
+			assertJSON(t, "request", out, tt.want)
+		})
+	}
+}
+
+func TestGeminiResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			"text with thoughts",
+			`{"modelVersion":"gemini-2.5","candidates":[{"content":{"parts":[{"text":"plan","thought":true},{"text":"done"}]},"finishReason":"MAX_TOKENS"}],
+			  "usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":4,"thoughtsTokenCount":5,"totalTokenCount":12}}`,
+			`{"id":"x","object":"chat.completion","created":1,"model":"gemini-2.5",
+			  "choices":[{"index":0,"finish_reason":"length","message":{"role":"assistant","content":"done","reasoning_content":"plan"}}],
+			  "usage":{"prompt_tokens":3,"completion_tokens":9,"total_tokens":12}}`,
+		},
+		{
+			"function call",
+			`{"candidates":[{"content":{"parts":[{"functionCall":{"name":"f","args":{"a":1}}}]},"finishReason":"STOP"}]}`,
+			`{"id":"x","object":"chat.completion","created":1,"model":"gemini",
+			  "choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":null,
+			    "tool_calls":[{"id":"call_0","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTranslator("gemini").(*geminiTranslator)
+			tr.Request(parseJSON(t, `{"model":"gemini","messages":[]}`))
+			tr.id, tr.created = "x", 1
+			got, err := tr.Response([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, "response", got, tt.want)
+		})
+	}
+}
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"anthropic", 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			`{"error":{"message":"Overloaded","type":"overloaded_error","code":529}}`},
+		{"gemini", 400, `{"error":{"code":400,"message":"bad","status":"INVALID_ARGUMENT"}}`,
+			`{"error":{"message":"bad","type":"INVALID_ARGUMENT","code":400}}`},
+		{"plain text", 502, "Bad Gateway\n",
+			`{"error":{"message":"Bad Gateway","type":"upstream_error","code":502}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+			json.Unmarshal(translateError(tt.status, []byte(tt.body)), &got)
+			assertJSON(t, "error", got, tt.want)
+		})
+	}
+}
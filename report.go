@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxReportBody caps how much of each request/response body a report keeps.
+const maxReportBody = 64 << 10
+
+// Report collects the outcome of every model/feature pair in a run and
+// renders it as a self-contained HTML file.
+type Report struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	BaseURL    string    `json:"base_url"`
+	Models     []string  `json:"models"`
+	Features   []string  `json:"features"`
+	Results    []Result  `json:"results"`
+}
+
+type Result struct {
+	Model      string     `json:"model"`
+	Feature    string     `json:"feature"`
+	Passed     bool       `json:"passed"`
+	Error      string     `json:"error,omitempty"`
+	DurationMs float64    `json:"duration_ms"`
+	Exchanges  []Exchange `json:"exchanges,omitempty"`
+}
+
+// Exchange is one HTTP round trip with secrets redacted. ChunkMs holds the
+// offset of every body read from the request start, which for SSE streams
+// approximates the arrival of each event batch.
+type Exchange struct {
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	Status          int               `json:"status"`
+	Error           string            `json:"error,omitempty"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     string            `json:"request_body"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body"`
+	Stream          bool              `json:"stream"`
+	TTFBMs          float64           `json:"ttfb_ms"`
+	DurationMs      float64           `json:"duration_ms"`
+	ChunkMs         []float64         `json:"chunk_ms,omitempty"`
+}
+
+func NewReport(baseURL string) *Report {
+	return &Report{StartedAt: time.Now(), BaseURL: redactURL(baseURL)}
+}
+
+func (r *Report) Add(model, feature string, err error, d time.Duration, exchanges []Exchange) {
+	res := Result{
+		Model:      model,
+		Feature:    feature,
+		Passed:     err == nil,
+		DurationMs: ms(d),
+		Exchanges:  exchanges,
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	r.Results = append(r.Results, res)
+	r.Models = appendUnique(r.Models, model)
+	r.Features = appendUnique(r.Features, feature)
+}
+
+func (r *Report) Result(model, feature string) *Result {
+	for i := range r.Results {
+		if r.Results[i].Model == model && r.Results[i].Feature == feature {
+			return &r.Results[i]
+		}
+	}
+	return nil
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// exchangeRecorder captures the HTTP exchanges of the feature currently running.
+type exchangeRecorder struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+// Take returns the exchanges recorded since the previous call and resets the list.
+func (rec *exchangeRecorder) Take() []Exchange {
+	if rec == nil {
+		return nil
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	ex := rec.exchanges
+	rec.exchanges = nil
+	return ex
+}
+
+func (rec *exchangeRecorder) add(ex Exchange) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.exchanges = append(rec.exchanges, ex)
+}
+
+func (rec *exchangeRecorder) Do(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	ex := Exchange{
+		Method:         req.Method,
+		URL:            redactURL(req.URL.String()),
+		RequestHeaders: redactHeaders(req.Header),
+		RequestBody:    redactBody(reqBody),
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ex.Error = err.Error()
+		ex.DurationMs = ms(time.Since(start))
+		rec.add(ex)
+		return nil, err
+	}
+
+	ex.Status = resp.StatusCode
+	ex.ResponseHeaders = redactHeaders(resp.Header)
+	ex.Stream = strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	ex.TTFBMs = ms(time.Since(start))
+	resp.Body = &timingBody{ReadCloser: resp.Body, start: start, ex: ex, rec: rec}
+	return resp, nil
+}
+
+// timingBody records when each read returns data and files the exchange
+// once the body is drained or closed.
+type timingBody struct {
+	io.ReadCloser
+	start time.Time
+	ex    Exchange
+	rec   *exchangeRecorder
+	buf   bytes.Buffer
+	once  sync.Once
+}
+
+func (b *timingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.ex.ChunkMs = append(b.ex.ChunkMs, ms(time.Since(b.start)))
+		b.buf.Write(p[:n])
+	}
+	if err != nil {
+		if err != io.EOF {
+			b.ex.Error = err.Error()
+		}
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *timingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *timingBody) finish() {
+	b.once.Do(func() {
+		b.ex.DurationMs = ms(time.Since(b.start))
+		b.ex.ResponseBody = redactBody(b.buf.Bytes())
+		b.rec.add(b.ex)
+	})
+}
+
+// sensitiveHeaders are the credential headers hidden in reports. They are
+// matched exactly, so that e.g. x-ratelimit-remaining-tokens stays readable.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"X-Api-Key":           true,
+	"Api-Key":             true,
+	"X-Goog-Api-Key":      true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// sensitiveParams are the lower-cased query parameters hidden in reports.
+var sensitiveParams = map[string]bool{
+	"key": true, "api_key": true, "apikey": true, "access_token": true,
+	"token": true, "secret": true, "password": true,
+}
+
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(k)] {
+			out[k] = "REDACTED"
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+// redactURL hides credentials passed in the query string, e.g. Gemini's ?key=.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	if u.User != nil {
+		u.User = url.User("REDACTED")
+	}
+	q := u.Query()
+	changed := false
+	for k := range q {
+		if sensitiveParams[strings.ToLower(k)] {
+			q.Set(k, "REDACTED")
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+var base64DataRe = regexp.MustCompile(`(data:[\w/.+-]+;base64,)([A-Za-z0-9+/=]+)`)
+
+// redactBody replaces inline base64 payloads with their length and hash and
+// truncates bodies larger than maxReportBody.
+func redactBody(body []byte) string {
+	s := base64DataRe.ReplaceAllStringFunc(string(body), func(m string) string {
+		parts := base64DataRe.FindStringSubmatch(m)
+		sum := sha256.Sum256([]byte(parts[2]))
+		return fmt.Sprintf("%s<%d bytes sha256:%s>", parts[1], len(parts[2]), hex.EncodeToString(sum[:8]))
+	})
+	if len(s) > maxReportBody {
+		cut := maxReportBody
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + fmt.Sprintf("\n... truncated %d bytes", len(s)-cut)
+	}
+	return s
+}
+
+// reportChange is the status difference of one model/feature pair between
+// the previous and the current report.
+type reportChange struct {
+	Model      string
+	Feature    string
+	Before     string
+	After      string
+	DurationMs [2]float64
+}
+
+func statusOf(r *Result) string {
+	switch {
+	case r == nil:
+		return "missing"
+	case r.Passed:
+		return "pass"
+	default:
+		return "fail"
+	}
+}
+
+// diffReports compares every model/feature pair present in either report.
+func diffReports(prev, cur *Report) (changes []reportChange, unchanged int) {
+	seen := make(map[[2]string]bool)
+	check := func(model, feature string) {
+		key := [2]string{model, feature}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		before, after := prev.Result(model, feature), cur.Result(model, feature)
+		if statusOf(before) == statusOf(after) {
+			unchanged++
+			return
+		}
+		c := reportChange{Model: model, Feature: feature, Before: statusOf(before), After: statusOf(after)}
+		if before != nil {
+			c.DurationMs[0] = before.DurationMs
+		}
+		if after != nil {
+			c.DurationMs[1] = after.DurationMs
+		}
+		changes = append(changes, c)
+	}
+	for _, r := range cur.Results {
+		check(r.Model, r.Feature)
+	}
+	for _, r := range prev.Results {
+		check(r.Model, r.Feature)
+	}
+	return changes, unchanged
+}
+
+const reportDataID = "llm-test-report-data"
+
+// LoadReport reads the run data embedded in a previously written HTML report.
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.Index(data, []byte(`id="`+reportDataID+`">`))
+	if start < 0 {
+		return nil, fmt.Errorf("%s: no embedded report data", path)
+	}
+	data = data[start+len(`id="`+reportDataID+`">`):]
+	end := bytes.Index(data, []byte("</script>"))
+	if end < 0 {
+		return nil, fmt.Errorf("%s: unterminated report data", path)
+	}
+	var r Report
+	if err := json.Unmarshal(data[:end], &r); err != nil {
+		return nil, fmt.Errorf("%s: failed to parse report data: %w", path, err)
+	}
+	return &r, nil
+}
+
+// WriteHTML renders the report to path, diffing against prev when not nil.
+func (r *Report) WriteHTML(path string, prev *Report) error {
+	r.FinishedAt = time.Now()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	view := struct {
+		*Report
+		Data      template.JS
+		Prev      *Report
+		Changes   []reportChange
+		Unchanged int
+	}{Report: r, Data: template.JS(data), Prev: prev}
+	if prev != nil {
+		view.Changes, view.Unchanged = diffReports(prev, r)
+	}
+
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, view); err != nil {
+		return fmt.Errorf("failed to render report: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// latencyChart draws the chunk arrival times of a streamed exchange as SVG ticks.
+func latencyChart(ex Exchange) template.HTML {
+	const width, height = 600.0, 40.0
+	total := ex.DurationMs
+	if total <= 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`, width, height, width, height)
+	fmt.Fprintf(&b, `<line x1="0" y1="%.0f" x2="%.0f" y2="%.0f" class="axis"/>`, height-1, width, height-1)
+	fmt.Fprintf(&b, `<line x1="%.1f" y1="0" x2="%.1f" y2="%.0f" class="ttfb"><title>TTFB %.0fms</title></line>`,
+		ex.TTFBMs/total*width, ex.TTFBMs/total*width, height, ex.TTFBMs)
+	for _, t := range ex.ChunkMs {
+		x := t / total * width
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="8" x2="%.1f" y2="%.0f" class="tick"><title>%.0fms</title></line>`, x, x, height-1, t)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"result": func(r *Report, model, feature string) *Result { return r.Result(model, feature) },
+	"status": statusOf,
+	"chart":  latencyChart,
+	"anchor": func(model, feature string) string {
+		return "r-" + unsafePathRe.ReplaceAllString(model+"-"+feature, "_")
+	},
+	"prettyJSON": func(s string) string {
+		var buf bytes.Buffer
+		if json.Indent(&buf, []byte(s), "", "  ") == nil {
+			return buf.String()
+		}
+		return s
+	},
+	"first": func(ms []float64) float64 {
+		if len(ms) == 0 {
+			return 0
+		}
+		return ms[0]
+	},
+	"time": func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>llm-test report {{time .StartedAt}}</title>
+<style>
+body { font-family: -apple-system, Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+td.pass { background: #d4f7d4; }
+td.fail { background: #f9d0d0; }
+td.missing { background: #eee; color: #888; }
+td a { color: inherit; text-decoration: none; }
+pre { background: #f6f6f6; padding: 8px; max-height: 400px; overflow: auto; white-space: pre-wrap; word-break: break-all; }
+.error { color: #b00; }
+.chart .axis { stroke: #888; }
+.chart .ttfb { stroke: #e08000; stroke-width: 2; }
+.chart .tick { stroke: #2a6fdb; }
+</style>
+</head>
+<body>
+<h1>llm-test report</h1>
+<p>Base URL: <code>{{.BaseURL}}</code><br>Started: {{time .StartedAt}}, finished: {{time .FinishedAt}}</p>
+
+<h2>Status</h2>
+<table>
+<tr><th>Model</th>{{range .Features}}<th>{{.}}</th>{{end}}</tr>
+{{- $r := .Report}}
+{{- range $model := .Models}}
+<tr><th>{{$model}}</th>
+{{- range $feature := $r.Features}}{{with result $r $model $feature}}
+<td class="{{status .}}"><a href="#{{anchor $model $feature}}">{{status .}} {{printf "%.0f" .DurationMs}}ms</a></td>
+{{- else}}<td class="missing">-</td>{{end}}{{end}}
+</tr>
+{{- end}}
+</table>
+
+{{if .Prev}}
+<h2>Changes since previous report ({{time .Prev.StartedAt}})</h2>
+{{if .Changes}}
+<table>
+<tr><th>Model</th><th>Feature</th><th>Before</th><th>After</th><th>Duration</th></tr>
+{{range .Changes}}
+<tr><td>{{.Model}}</td><td>{{.Feature}}</td><td class="{{.Before}}">{{.Before}}</td><td class="{{.After}}">{{.After}}</td>
+<td>{{printf "%.0f" (index .DurationMs 0)}}ms → {{printf "%.0f" (index .DurationMs 1)}}ms</td></tr>
+{{end}}
+</table>
+{{end}}
+<p>{{.Unchanged}} model/feature pairs unchanged.</p>
+{{end}}
+
+<h2>Details</h2>
+{{range .Results}}
+<h3 id="{{anchor .Model .Feature}}">{{.Model}} / {{.Feature}}: <span class="{{status .}}">{{status .}}</span> ({{printf "%.0f" .DurationMs}}ms)</h3>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{range $i, $ex := .Exchanges}}
+<details>
+<summary>{{$ex.Method}} {{$ex.URL}} → {{if $ex.Status}}{{$ex.Status}}{{else}}{{$ex.Error}}{{end}}
+ ({{printf "%.0f" $ex.DurationMs}}ms{{if $ex.Stream}}, stream: TTFB {{printf "%.0f" $ex.TTFBMs}}ms, first chunk {{printf "%.0f" (first $ex.ChunkMs)}}ms, {{len $ex.ChunkMs}} reads{{end}})</summary>
+{{if $ex.Stream}}{{chart $ex}}{{end}}
+<p>Request headers</p>
+<pre>{{range $k, $v := $ex.RequestHeaders}}{{$k}}: {{$v}}
+{{end}}</pre>
+<p>Request body</p>
+<pre>{{prettyJSON $ex.RequestBody}}</pre>
+<p>Response headers</p>
+<pre>{{range $k, $v := $ex.ResponseHeaders}}{{$k}}: {{$v}}
+{{end}}</pre>
+<p>Response body</p>
+<pre>{{prettyJSON $ex.ResponseBody}}</pre>
+</details>
+{{end}}
+{{end}}
+
+<script type="application/json" id="` + reportDataID + `">{{.Data}}</script>
+</body>
+</html>
+`))
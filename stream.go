@@ -4,16 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
 
 	"github.com/sashabaranov/go-openai"
 )
 
-func stream(ctx context.Context, client *openai.Client) {
+func stream(ctx context.Context, client *openai.Client, model string) error {
 	fmt.Println("----- Stream Chat Completion Test -----")
 
 	req := openai.ChatCompletionRequest{
-		Model: os.Getenv("MODEL"),
+		Model: model,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleSystem,
@@ -34,7 +33,7 @@ func stream(ctx context.Context, client *openai.Client) {
 	stream, err := client.CreateChatCompletionStream(ctx, req)
 	if err != nil {
 		fmt.Printf("Stream creation error: %v\n", err)
-		return
+		return fmt.Errorf("create stream: %w", err)
 	}
 	defer stream.Close()
 
@@ -49,7 +48,7 @@ func stream(ctx context.Context, client *openai.Client) {
 				break
 			}
 			fmt.Printf("\nStream error: %v\n", err)
-			return
+			return fmt.Errorf("recv: %w", err)
 		}
 
 		if len(response.Choices) > 0 {
@@ -59,4 +58,5 @@ func stream(ctx context.Context, client *openai.Client) {
 	}
 
 	fmt.Println("--------------------------------")
+	return nil
 }
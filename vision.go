@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,19 +11,21 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
-func vision(ctx context.Context, client *openai.Client) {
+func vision(ctx context.Context, client *openai.Client, model string) error {
 	fmt.Println("----- OpenAI Vision API Test -----")
 
 	// Test 1: Base64 format
 	fmt.Println("\n=== Test 1: Base64 Format ===")
-	testVisionBase64(ctx, client)
+	errBase64 := testVisionBase64(ctx, client, model)
 
 	// Test 2: URL format (assuming you have the image accessible via URL)
 	fmt.Println("\n=== Test 2: URL Format ===")
-	testVisionURL(ctx, client)
+	errURL := testVisionURL(ctx, client, model)
+
+	return errors.Join(errBase64, errURL)
 }
 
-func testVisionBase64(ctx context.Context, client *openai.Client) {
+func testVisionBase64(ctx context.Context, client *openai.Client, model string) error {
 	// Read and encode the image to base64
 
 	imgPath := "./kodata/lightning-bolts.jpg"
@@ -32,11 +35,11 @@ func testVisionBase64(ctx context.Context, client *openai.Client) {
 	imageData, err := readImageAsBase64(imgPath)
 	if err != nil {
 		fmt.Printf("Error reading image: %v\n", err)
-		return
+		return fmt.Errorf("base64: %w", err)
 	}
 
 	req := openai.ChatCompletionRequest{
-		Model: os.Getenv("MODEL"),
+		Model: model,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role: openai.ChatMessageRoleUser,
@@ -60,7 +63,7 @@ func testVisionBase64(ctx context.Context, client *openai.Client) {
 	resp, err := client.CreateChatCompletion(ctx, req)
 	if err != nil {
 		fmt.Printf("Vision API error (base64): %v\n", err)
-		return
+		return fmt.Errorf("base64: %w", err)
 	}
 
 	fmt.Println("Base64 Response:")
@@ -68,13 +71,14 @@ func testVisionBase64(ctx context.Context, client *openai.Client) {
 	if len(resp.Choices) > 0 {
 		fmt.Printf("\nVision Analysis (Base64): %s\n", resp.Choices[0].Message.Content)
 	}
+	return nil
 }
 
-func testVisionURL(ctx context.Context, client *openai.Client) {
+func testVisionURL(ctx context.Context, client *openai.Client, model string) error {
 	imageURL := "https://images.nationalgeographic.org/image/upload/t_edhub_resource_key_image/v1638886301/EducationHub/photos/lightning-bolts.jpg"
 
 	req := openai.ChatCompletionRequest{
-		Model: os.Getenv("MODEL"),
+		Model: model,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role: openai.ChatMessageRoleUser,
@@ -102,7 +106,7 @@ func testVisionURL(ctx context.Context, client *openai.Client) {
 	resp, err := client.CreateChatCompletion(ctx, req)
 	if err != nil {
 		fmt.Printf("Vision API error (URL): %v\n", err)
-		return
+		return fmt.Errorf("url: %w", err)
 	}
 
 	fmt.Println("URL Response:")
@@ -110,6 +114,7 @@ func testVisionURL(ctx context.Context, client *openai.Client) {
 	if len(resp.Choices) > 0 {
 		fmt.Printf("\nVision Analysis (URL): %s\n", resp.Choices[0].Message.Content)
 	}
+	return nil
 }
 
 // readImageAsBase64 reads an image file and returns it as a base64 encoded string